@@ -2,23 +2,54 @@ package go_cover_storage
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"io"
+	"net/http"
 	"sort"
 	"strconv"
+	"strings"
+	"time"
 )
 
+// 开启版本控制后 oss 在该响应头中返回版本号
+const ossHeaderVersionId = "X-Oss-Version-Id"
+
 // 阿里云存储 oss
 type aliyun struct {
 	accessKeyId, accessKeySecret string
+	connOptions
+	cache *clientCache
+}
+
+func init() {
+	Aliyun = &aliyun{}
+	mustRegisterProvider("aliyun", Aliyun.Init)
+}
+
+func (a *aliyun) getOssEndpoint(region string) string {
+	return a.getEndpoint("oss-" + a.getRegion(region) + ".aliyuncs.com")
 }
 
+// 每个地域的 oss.Client 只创建一次，共用同一个连接池
 func (a *aliyun) getOssClientBucket(bucketName, region string) (*oss.Bucket, error) {
-	endpoint := "oss-" + region + ".aliyuncs.com"
-	client, err := oss.New(endpoint, a.accessKeyId, a.accessKeySecret)
+	endpoint := a.getScheme("http") + "://" + a.getOssEndpoint(region)
+	value, err := a.cache.get(cacheKey("oss", endpoint), func() (interface{}, error) {
+		httpClient := &http.Client{Transport: a.cache.transport(), Timeout: a.timeout}
+		return oss.New(endpoint, a.accessKeyId, a.accessKeySecret, oss.HTTPClient(httpClient))
+	})
 	if err != nil {
 		return nil, err
 	}
-	return client.Bucket(bucketName)
+	return value.(*oss.Client).Bucket(bucketName)
+}
+
+func (a *aliyun) Close() error {
+	a.cache.close()
+	return nil
 }
 
 func (a *aliyun) DoUploadPart(bucket oss.Bucket, request *oss.UploadPartRequest, options []oss.Option) (*oss.UploadPartResult, error) {
@@ -49,17 +80,17 @@ func (a *aliyun) DoUploadPart(bucket oss.Bucket, request *oss.UploadPartRequest,
 }
 
 func (a *aliyun) Init(options map[string]interface{}) (StoreClient, error) {
-	accessKey, secretKey, err := getAccessKeySecretKey(options)
-	if err != nil {
-		return nil, err
-	}
-	return &aliyun{
-		accessKeyId:     accessKey,
-		accessKeySecret: secretKey,
-	}, nil
+	return initClient("aliyun", options)
 }
 
 func (a *aliyun) MultipartUploadInit(bucketName, region, objectKey string) (string, error) {
+	return a.MultipartUploadInitWithContext(context.Background(), bucketName, region, objectKey)
+}
+
+func (a *aliyun) MultipartUploadInitWithContext(ctx context.Context, bucketName, region, objectKey string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
 	bucket, err := a.getOssClientBucket(bucketName, region)
 	if err != nil {
 		return "", err
@@ -72,7 +103,22 @@ func (a *aliyun) MultipartUploadInit(bucketName, region, objectKey string) (stri
 	return result.UploadID, nil
 }
 
-func (a *aliyun) MultipartUploadPart(bucketName, region, objectKey, uploadId string, partNumber uint, body []byte) (H, error) {
+func (a *aliyun) MultipartUploadPart(bucketName, region, objectKey, uploadId string, partNumber uint, body []byte) (*UploadPartResult, error) {
+	return a.MultipartUploadPartWithContext(context.Background(), bucketName, region, objectKey, uploadId, partNumber, body)
+}
+
+func (a *aliyun) MultipartUploadPartWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string, partNumber uint, body []byte) (*UploadPartResult, error) {
+	return a.MultipartUploadPartFromReaderWithContext(ctx, bucketName, region, objectKey, uploadId, partNumber, bytes.NewReader(body), int64(len(body)))
+}
+
+func (a *aliyun) MultipartUploadPartFromReader(bucketName, region, objectKey, uploadId string, partNumber uint, reader io.Reader, size int64) (*UploadPartResult, error) {
+	return a.MultipartUploadPartFromReaderWithContext(context.Background(), bucketName, region, objectKey, uploadId, partNumber, reader, size)
+}
+
+func (a *aliyun) MultipartUploadPartFromReaderWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string, partNumber uint, reader io.Reader, size int64) (*UploadPartResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	bucket, err := a.getOssClientBucket(bucketName, region)
 	if err != nil {
 		return nil, err
@@ -82,24 +128,52 @@ func (a *aliyun) MultipartUploadPart(bucketName, region, objectKey, uploadId str
 		Key:      objectKey,
 		UploadID: uploadId,
 	}
-	fd := bytes.NewReader(body)
+	checksumReader := newChecksumReader(io.LimitReader(reader, size))
 	request := &oss.UploadPartRequest{
 		InitResult: &InitResult,
-		Reader:     fd,
-		PartSize:   fd.Size(),
+		Reader:     newContextReader(ctx, checksumReader),
+		PartSize:   size,
 		PartNumber: int(partNumber),
 	}
-	result, err := a.DoUploadPart(*bucket, request, nil)
+	progress := startPartProgress(ctx, "aliyun", bucketName, objectKey, uploadId, partNumber, size)
+	options := make([]oss.Option, 0)
+	if progress != nil {
+		options = append(options, oss.Progress(&ossProgressListener{progress: progress}))
+	}
+	result, err := a.DoUploadPart(*bucket, request, options)
 	if err != nil {
+		progress.finish(nil, err)
 		return nil, err
 	}
-	return H{
-		"PartNumber": result.Part.PartNumber,
-		"ETag":       result.Part.ETag,
-	}, nil
+	partResult := &UploadPartResult{
+		PartNumber: partNumber,
+		ETag:       result.Part.ETag,
+		Size:       size,
+		Checksum:   checksumReader.Checksum(),
+	}
+	progress.finish(partResult, nil)
+	return partResult, nil
+}
+
+// 把 oss 的进度回调转换为 PartDataEvent
+type ossProgressListener struct {
+	progress *partProgress
 }
 
-func (a *aliyun) MultipartUploadComplete(bucketName, region, objectKey, uploadId string, parts map[uint]string) (H, error) {
+func (l *ossProgressListener) ProgressChanged(event *oss.ProgressEvent) {
+	if event.EventType == oss.TransferDataEvent {
+		l.progress.set(event.ConsumedBytes)
+	}
+}
+
+func (a *aliyun) MultipartUploadComplete(bucketName, region, objectKey, uploadId string, parts map[uint]string) (*CompleteResult, error) {
+	return a.MultipartUploadCompleteWithContext(context.Background(), bucketName, region, objectKey, uploadId, parts)
+}
+
+func (a *aliyun) MultipartUploadCompleteWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string, parts map[uint]string) (*CompleteResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	bucket, err := a.getOssClientBucket(bucketName, region)
 	if err != nil {
 		return nil, err
@@ -123,10 +197,397 @@ func (a *aliyun) MultipartUploadComplete(bucketName, region, objectKey, uploadId
 	if err != nil {
 		return nil, err
 	}
-	return H{
-		"Location": result.Location,
-		"Bucket":   result.Bucket,
-		"ETag":     result.ETag,
-		"Key":      result.Key,
+	return &CompleteResult{
+		Bucket:   result.Bucket,
+		Key:      result.Key,
+		ETag:     result.ETag,
+		Location: result.Location,
+	}, nil
+}
+
+func (a *aliyun) MultipartUploadAbort(bucketName, region, objectKey, uploadId string) error {
+	return a.MultipartUploadAbortWithContext(context.Background(), bucketName, region, objectKey, uploadId)
+}
+
+func (a *aliyun) MultipartUploadAbortWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	bucket, err := a.getOssClientBucket(bucketName, region)
+	if err != nil {
+		return err
+	}
+	InitResult := oss.InitiateMultipartUploadResult{
+		Bucket:   bucketName,
+		Key:      objectKey,
+		UploadID: uploadId,
+	}
+	return bucket.AbortMultipartUpload(InitResult)
+}
+
+func (a *aliyun) MultipartUploadListParts(bucketName, region, objectKey, uploadId string) ([]Part, error) {
+	return a.MultipartUploadListPartsWithContext(context.Background(), bucketName, region, objectKey, uploadId)
+}
+
+func (a *aliyun) MultipartUploadListPartsWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string) ([]Part, error) {
+	bucket, err := a.getOssClientBucket(bucketName, region)
+	if err != nil {
+		return nil, err
+	}
+	InitResult := oss.InitiateMultipartUploadResult{
+		Bucket:   bucketName,
+		Key:      objectKey,
+		UploadID: uploadId,
+	}
+	parts := make([]Part, 0)
+	marker := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		result, err := bucket.ListUploadedParts(InitResult, oss.PartNumberMarker(marker))
+		if err != nil {
+			return nil, err
+		}
+		for _, part := range result.UploadedParts {
+			parts = append(parts, Part{
+				PartNumber:   part.PartNumber,
+				ETag:         part.ETag,
+				Size:         int64(part.Size),
+				LastModified: part.LastModified,
+			})
+		}
+		if !result.IsTruncated {
+			return parts, nil
+		}
+		if marker, err = strconv.Atoi(result.NextPartNumberMarker); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (a *aliyun) ListMultipartUploads(bucketName, region, prefix, marker string, maxUploads int) (*MultipartUploadList, error) {
+	return a.ListMultipartUploadsWithContext(context.Background(), bucketName, region, prefix, marker, maxUploads)
+}
+
+func (a *aliyun) ListMultipartUploadsWithContext(ctx context.Context, bucketName, region, prefix, marker string, maxUploads int) (*MultipartUploadList, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	keyMarker, uploadIdMarker, err := decodeUploadMarker(marker)
+	if err != nil {
+		return nil, err
+	}
+	if maxUploads <= 0 {
+		maxUploads = defaultMaxUploads
+	}
+	bucket, err := a.getOssClientBucket(bucketName, region)
+	if err != nil {
+		return nil, err
+	}
+	result, err := bucket.ListMultipartUploads(
+		oss.Prefix(prefix), oss.KeyMarker(keyMarker), oss.UploadIDMarker(uploadIdMarker), oss.MaxUploads(maxUploads),
+	)
+	if err != nil {
+		return nil, err
+	}
+	list := &MultipartUploadList{Uploads: make([]MultipartUpload, 0, len(result.Uploads))}
+	for _, upload := range result.Uploads {
+		list.Uploads = append(list.Uploads, MultipartUpload{
+			Key:       upload.Key,
+			UploadId:  upload.UploadID,
+			Initiated: upload.Initiated,
+		})
+	}
+	if result.IsTruncated {
+		list.NextMarker = encodeUploadMarker(result.NextKeyMarker, result.NextUploadIDMarker)
+	}
+	return list, nil
+}
+
+func (a *aliyun) PutObject(bucketName, region, objectKey string, reader io.Reader, size int64, opts *PutObjectOptions) (*CompleteResult, error) {
+	return a.PutObjectWithContext(context.Background(), bucketName, region, objectKey, reader, size, opts)
+}
+
+func (a *aliyun) PutObjectWithContext(ctx context.Context, bucketName, region, objectKey string, reader io.Reader, size int64, opts *PutObjectOptions) (*CompleteResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	bucket, err := a.getOssClientBucket(bucketName, region)
+	if err != nil {
+		return nil, err
+	}
+	options := []oss.Option{oss.ContentLength(size)}
+	if opts != nil {
+		if opts.ContentType != "" {
+			options = append(options, oss.ContentType(opts.ContentType))
+		}
+		for key, value := range opts.Metadata {
+			options = append(options, oss.Meta(key, value))
+		}
+	}
+	request := &oss.PutObjectRequest{
+		ObjectKey: objectKey,
+		Reader:    newContextReader(ctx, io.LimitReader(reader, size)),
+	}
+	resp, err := bucket.DoPutObject(request, options)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return &CompleteResult{
+		Bucket:    bucketName,
+		Key:       objectKey,
+		ETag:      resp.Headers.Get(oss.HTTPHeaderEtag),
+		VersionID: resp.Headers.Get(ossHeaderVersionId),
+	}, nil
+}
+
+func (a *aliyun) GetObject(bucketName, region, objectKey string, opts *GetObjectOptions) (io.ReadCloser, error) {
+	return a.GetObjectWithContext(context.Background(), bucketName, region, objectKey, opts)
+}
+
+func (a *aliyun) GetObjectWithContext(ctx context.Context, bucketName, region, objectKey string, opts *GetObjectOptions) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	bucket, err := a.getOssClientBucket(bucketName, region)
+	if err != nil {
+		return nil, err
+	}
+	options := make([]oss.Option, 0)
+	if byteRange := opts.byteRange(); byteRange != nil {
+		options = append(options, oss.NormalizedRange(strings.TrimPrefix(byteRange.String(), "bytes=")))
+	}
+	body, err := bucket.GetObject(objectKey, options...)
+	if err != nil {
+		return nil, err
+	}
+	return newContextReadCloser(ctx, body), nil
+}
+
+func (a *aliyun) StatObject(bucketName, region, objectKey string) (*ObjectInfo, error) {
+	return a.StatObjectWithContext(context.Background(), bucketName, region, objectKey)
+}
+
+func (a *aliyun) StatObjectWithContext(ctx context.Context, bucketName, region, objectKey string) (*ObjectInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	bucket, err := a.getOssClientBucket(bucketName, region)
+	if err != nil {
+		return nil, err
+	}
+	header, err := bucket.GetObjectDetailedMeta(objectKey)
+	if err != nil {
+		var serviceErr oss.ServiceError
+		if errors.As(err, &serviceErr) && serviceErr.StatusCode == http.StatusNotFound {
+			return nil, wrapNotFound(err)
+		}
+		return nil, err
+	}
+	size, _ := strconv.ParseInt(header.Get(oss.HTTPHeaderContentLength), 10, 64)
+	lastModified, _ := http.ParseTime(header.Get(oss.HTTPHeaderLastModified))
+	return &ObjectInfo{
+		Key:          objectKey,
+		Size:         size,
+		ETag:         header.Get(oss.HTTPHeaderEtag),
+		ContentType:  header.Get(oss.HTTPHeaderContentType),
+		LastModified: lastModified,
+		Metadata:     metadataFromHeader(header, "x-oss-meta-"),
+	}, nil
+}
+
+func (a *aliyun) DeleteObject(bucketName, region, objectKey string) error {
+	return a.DeleteObjectWithContext(context.Background(), bucketName, region, objectKey)
+}
+
+func (a *aliyun) DeleteObjectWithContext(ctx context.Context, bucketName, region, objectKey string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	bucket, err := a.getOssClientBucket(bucketName, region)
+	if err != nil {
+		return err
+	}
+	return bucket.DeleteObject(objectKey)
+}
+
+func (a *aliyun) DeleteObjects(bucketName, region string, objectKeys []string) ([]DeleteResult, error) {
+	return a.DeleteObjectsWithContext(context.Background(), bucketName, region, objectKeys)
+}
+
+func (a *aliyun) DeleteObjectsWithContext(ctx context.Context, bucketName, region string, objectKeys []string) ([]DeleteResult, error) {
+	bucket, err := a.getOssClientBucket(bucketName, region)
+	if err != nil {
+		return nil, err
+	}
+	failed := make(map[string]error)
+	for _, keys := range chunkKeys(objectKeys, maxDeleteObjects) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		result, err := bucket.DeleteObjects(keys)
+		if err != nil {
+			return nil, err
+		}
+		// oss 只返回删除成功的对象
+		deleted := make(map[string]bool, len(result.DeletedObjects))
+		for _, key := range result.DeletedObjects {
+			deleted[key] = true
+		}
+		for _, key := range keys {
+			if !deleted[key] {
+				failed[key] = fmt.Errorf("object %s was not deleted", key)
+			}
+		}
+	}
+	return deleteResults(objectKeys, failed), nil
+}
+
+func (a *aliyun) ListObjects(bucketName, region, prefix, delimiter, continuationToken string, maxKeys int) (*ObjectList, error) {
+	return a.ListObjectsWithContext(context.Background(), bucketName, region, prefix, delimiter, continuationToken, maxKeys)
+}
+
+func (a *aliyun) ListObjectsWithContext(ctx context.Context, bucketName, region, prefix, delimiter, continuationToken string, maxKeys int) (*ObjectList, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	bucket, err := a.getOssClientBucket(bucketName, region)
+	if err != nil {
+		return nil, err
+	}
+	if maxKeys <= 0 {
+		maxKeys = defaultMaxKeys
+	}
+	options := []oss.Option{oss.Prefix(prefix), oss.MaxKeys(maxKeys)}
+	if delimiter != "" {
+		options = append(options, oss.Delimiter(delimiter))
+	}
+	if continuationToken != "" {
+		options = append(options, oss.ContinuationToken(continuationToken))
+	}
+	result, err := bucket.ListObjectsV2(options...)
+	if err != nil {
+		return nil, err
+	}
+	list := &ObjectList{
+		Objects:        make([]ObjectInfo, 0, len(result.Objects)),
+		CommonPrefixes: result.CommonPrefixes,
+	}
+	for _, object := range result.Objects {
+		list.Objects = append(list.Objects, ObjectInfo{
+			Key:          object.Key,
+			Size:         object.Size,
+			ETag:         object.ETag,
+			LastModified: object.LastModified,
+		})
+	}
+	if result.IsTruncated {
+		list.NextContinuationToken = result.NextContinuationToken
+	}
+	return list, nil
+}
+
+func (a *aliyun) CopyObject(bucketName, region, objectKey, srcBucketName, srcObjectKey string) (*CompleteResult, error) {
+	return a.CopyObjectWithContext(context.Background(), bucketName, region, objectKey, srcBucketName, srcObjectKey)
+}
+
+func (a *aliyun) CopyObjectWithContext(ctx context.Context, bucketName, region, objectKey, srcBucketName, srcObjectKey string) (*CompleteResult, error) {
+	srcInfo, err := a.StatObjectWithContext(ctx, srcBucketName, region, srcObjectKey)
+	if err != nil {
+		return nil, err
+	}
+	bucket, err := a.getOssClientBucket(bucketName, region)
+	if err != nil {
+		return nil, err
+	}
+	if srcInfo.Size > maxCopyObjectSize {
+		return multipartCopy(ctx, a, bucketName, region, objectKey, srcInfo.Size, func(uploadId string, partNumber int, start, end int64) (string, error) {
+			if err := ctx.Err(); err != nil {
+				return "", err
+			}
+			imur := oss.InitiateMultipartUploadResult{
+				Bucket:   bucketName,
+				Key:      objectKey,
+				UploadID: uploadId,
+			}
+			part, err := bucket.UploadPartCopy(imur, srcBucketName, srcObjectKey, start, end-start+1, partNumber)
+			if err != nil {
+				return "", err
+			}
+			return part.ETag, nil
+		})
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	var respHeader http.Header
+	result, err := bucket.CopyObjectFrom(srcBucketName, srcObjectKey, objectKey, oss.GetResponseHeader(&respHeader))
+	if err != nil {
+		return nil, err
+	}
+	return &CompleteResult{
+		Bucket:    bucketName,
+		Key:       objectKey,
+		ETag:      result.ETag,
+		VersionID: respHeader.Get(ossHeaderVersionId),
+	}, nil
+}
+
+func (a *aliyun) PresignURL(method, bucketName, region, objectKey string, expiry time.Duration) (string, error) {
+	method, err := checkPresign(method, expiry)
+	if err != nil {
+		return "", err
+	}
+	bucket, err := a.getOssClientBucket(bucketName, region)
+	if err != nil {
+		return "", err
+	}
+	return bucket.SignURL(objectKey, oss.HTTPMethod(method), int64(expiry/time.Second))
+}
+
+// 分片的 ETag 在响应头 ETag 中，浏览器读取需要在 bucket 的 CORS 规则中暴露 ETag
+func (a *aliyun) PresignMultipartUploadPart(bucketName, region, objectKey, uploadId string, partNumber uint, expiry time.Duration) (*PresignedPartRequest, error) {
+	if _, err := checkPresign(http.MethodPut, expiry); err != nil {
+		return nil, err
+	}
+	bucket, err := a.getOssClientBucket(bucketName, region)
+	if err != nil {
+		return nil, err
+	}
+	expiration := time.Now().Add(expiry)
+	signedURL, err := bucket.SignURL(objectKey, oss.HTTPPut, int64(expiry/time.Second),
+		oss.AddParam("partNumber", strconv.Itoa(int(partNumber))), oss.AddParam("uploadId", uploadId))
+	if err != nil {
+		return nil, err
+	}
+	return &PresignedPartRequest{
+		PartNumber: partNumber,
+		Method:     http.MethodPut,
+		URL:        signedURL,
+		Header:     http.Header{},
+		Expiration: expiration,
+	}, nil
+}
+
+func (a *aliyun) PresignPostPolicy(bucketName, region string, policy *PostPolicy) (*PostPolicyForm, error) {
+	if err := checkPostPolicy(policy); err != nil {
+		return nil, err
+	}
+	expiration := time.Now().Add(policy.Expiry)
+	document, err := marshalPostPolicy(expiration, policy.conditions(bucketName))
+	if err != nil {
+		return nil, err
+	}
+	encodedPolicy := base64.StdEncoding.EncodeToString(document)
+	fields := policy.formFields()
+	fields["OSSAccessKeyId"] = a.accessKeyId
+	fields["policy"] = encodedPolicy
+	fields["Signature"] = base64.StdEncoding.EncodeToString(hmacSHA1([]byte(a.accessKeySecret), encodedPolicy))
+	return &PostPolicyForm{
+		URL:        a.getScheme("https") + "://" + bucketName + "." + a.getOssEndpoint(region),
+		Fields:     fields,
+		Expiration: expiration,
 	}, nil
 }
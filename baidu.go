@@ -1,34 +1,166 @@
 package go_cover_storage
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"github.com/baidubce/bce-sdk-go/bce"
+	bcehttp "github.com/baidubce/bce-sdk-go/http"
 	"github.com/baidubce/bce-sdk-go/services/bos"
 	"github.com/baidubce/bce-sdk-go/services/bos/api"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // 百度云存储 bce
 type baidu struct {
 	accessKey, secretKey string
+	connOptions
+	cache *clientCache
 }
 
+func init() {
+	Baidu = &baidu{}
+	mustRegisterProvider("baidu", Baidu.Init)
+}
+
+func (b *baidu) getBosEndpoint(region string) string {
+	return b.getEndpoint(b.getRegion(region) + ".bcebos.com")
+}
+
+// 每个地域的 bos.Client 只创建一次，bce 使用全局的连接池
 func (b *baidu) getBosNewClient(region string) (*bos.Client, error) {
-	endpoint := "http://" + region + ".bcebos.com"
-	return bos.NewClient(b.accessKey, b.secretKey, endpoint)
+	return b.getBosClient(region, false)
 }
 
-func (b *baidu) Init(options map[string]interface{}) (StoreClient, error) {
-	accessKey, secretKey, err := getAccessKeySecretKey(options)
+// 发送不能重新读取的数据流时使用的 bos.Client
+// bce 默认的重试策略会把整个请求体复制到内存中用于重发，这里不重试，失败的分片由调用方重新上传
+func (b *baidu) getBosStreamClient(region string) (*bos.Client, error) {
+	return b.getBosClient(region, true)
+}
+
+func (b *baidu) getBosClient(region string, stream bool) (*bos.Client, error) {
+	endpoint := b.getScheme("http") + "://" + b.getBosEndpoint(region)
+	value, err := b.cache.get(cacheKey("bos", endpoint, strconv.FormatBool(stream)), func() (interface{}, error) {
+		bosClient, err := bos.NewClient(b.accessKey, b.secretKey, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		if stream {
+			bosClient.Config.Retry = bce.NewNoRetryPolicy()
+		}
+		bosClient.Config.ConnectionTimeoutInMillis = bosTimeoutInMillis(b.timeout)
+		return bosClient, nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	return &baidu{
-		accessKey: accessKey,
-		secretKey: secretKey,
-	}, nil
+	return value.(*bos.Client), nil
+}
+
+// bce 把 ConnectionTimeoutInMillis 按整秒设置为 http.Client.Timeout，是包括读取响应的整个请求的超时
+// 不足一秒的部分向上取整，避免被截断为 0 变成不限制；timeout 为 0 时同样不限制，不使用 bce 默认的 20 分钟
+func bosTimeoutInMillis(timeout time.Duration) int {
+	if timeout <= 0 {
+		return 0
+	}
+	seconds := (timeout + time.Second - 1) / time.Second
+	return int(seconds * 1000)
+}
+
+func (b *baidu) Close() error {
+	b.cache.close()
+	return nil
+}
+
+// *os.File 按区间读取，可以预先计算 Content-MD5，构造 bce.Body 使用 sdk 上传
+// 其他 reader 和管道、标准输入等不能 Seek 的文件返回 nil，由 putBosStream 直接发送
+func newBosBodyFromFile(reader io.Reader, size int64) (*bce.Body, error) {
+	file, ok := reader.(*os.File)
+	if !ok {
+		return nil, nil
+	}
+	offset, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, nil
+	}
+	body, err := bce.NewBodyFromSectionFile(file, offset, size)
+	if err != nil {
+		return nil, err
+	}
+	// NewBodyFromSectionFile 会把文件指针移到开头，这里恢复为读取完该分片后的位置
+	if _, err = file.Seek(offset+size, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// 以 PUT 请求直接发送 reader 中的 size 字节，返回去掉引号的 etag
+// bce.Body 只能先读取全部数据计算 Content-MD5，bos 不要求 Content-MD5，这里不发送，数据边读边发
+// 使用不重试的 bos.Client 发送，否则重试策略仍会把数据复制到内存中
+func (b *baidu) putBosStream(region, bucketName, objectKey string, params, headers map[string]string, reader io.Reader, size int64) (string, error) {
+	bosClient, err := b.getBosStreamClient(region)
+	if err != nil {
+		return "", err
+	}
+	counter := &countingReader{reader: io.LimitReader(reader, size)}
+	req := &bce.BceRequest{}
+	req.SetUri(bce.URI_PREFIX + bucketName + "/" + objectKey)
+	req.SetMethod(bcehttp.PUT)
+	req.SetParams(params)
+	req.SetHeaders(headers)
+	req.Request.SetBody(ioutil.NopCloser(counter))
+	req.SetLength(size)
+	req.SetHeader(bcehttp.CONTENT_LENGTH, strconv.FormatInt(size, 10))
+	resp := &bce.BceResponse{}
+	err = api.SendRequest(bosClient, req, resp)
+	// reader 提前结束时请求可能已经发送，不能当作成功
+	if err == nil && counter.n < size {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body().Close()
+	if resp.IsFail() {
+		return "", resp.ServiceError()
+	}
+	return strings.Trim(resp.Header(bcehttp.ETAG), `"`), nil
+}
+
+// 统计读取的字节数
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func (b *baidu) Init(options map[string]interface{}) (StoreClient, error) {
+	return initClient("baidu", options)
 }
 
 func (b *baidu) MultipartUploadInit(bucketName, region, objectKey string) (string, error) {
+	return b.MultipartUploadInitWithContext(context.Background(), bucketName, region, objectKey)
+}
+
+func (b *baidu) MultipartUploadInitWithContext(ctx context.Context, bucketName, region, objectKey string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
 	bosClient, err := b.getBosNewClient(region)
 	if err != nil {
 		return "", err
@@ -40,26 +172,65 @@ func (b *baidu) MultipartUploadInit(bucketName, region, objectKey string) (strin
 	return result.UploadId, nil
 }
 
-func (b *baidu) MultipartUploadPart(bucketName, region, objectKey, uploadId string, partNumber uint, body []byte) (H, error) {
+func (b *baidu) MultipartUploadPart(bucketName, region, objectKey, uploadId string, partNumber uint, body []byte) (*UploadPartResult, error) {
+	return b.MultipartUploadPartWithContext(context.Background(), bucketName, region, objectKey, uploadId, partNumber, body)
+}
+
+func (b *baidu) MultipartUploadPartWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string, partNumber uint, body []byte) (*UploadPartResult, error) {
+	return b.MultipartUploadPartFromReaderWithContext(ctx, bucketName, region, objectKey, uploadId, partNumber, bytes.NewReader(body), int64(len(body)))
+}
+
+func (b *baidu) MultipartUploadPartFromReader(bucketName, region, objectKey, uploadId string, partNumber uint, reader io.Reader, size int64) (*UploadPartResult, error) {
+	return b.MultipartUploadPartFromReaderWithContext(context.Background(), bucketName, region, objectKey, uploadId, partNumber, reader, size)
+}
+
+func (b *baidu) MultipartUploadPartFromReaderWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string, partNumber uint, reader io.Reader, size int64) (*UploadPartResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	bosClient, err := b.getBosNewClient(region)
 	if err != nil {
 		return nil, err
 	}
-	partBody, err := bce.NewBodyFromBytes(body)
+	partBody, err := newBosBodyFromFile(reader, size)
 	if err != nil {
 		return nil, err
 	}
-	etag, err := bosClient.BasicUploadPart(bucketName, objectKey, uploadId, int(partNumber), partBody)
+	progress := startPartProgress(ctx, "baidu", bucketName, objectKey, uploadId, partNumber, size)
+	var etag, checksum string
+	if partBody != nil {
+		partBody.SetStream(ioutil.NopCloser(newContextReader(ctx, progress.reader(partBody.Stream()))))
+		etag, err = bosClient.BasicUploadPart(bucketName, objectKey, uploadId, int(partNumber), partBody)
+		// bce.Body 创建时已经计算了 Content-MD5
+		checksum = partBody.ContentMD5()
+	} else {
+		checksumReader := newChecksumReader(reader)
+		params := map[string]string{"uploadId": uploadId, "partNumber": strconv.Itoa(int(partNumber))}
+		etag, err = b.putBosStream(region, bucketName, objectKey, params, nil, newContextReader(ctx, progress.reader(checksumReader)), size)
+		checksum = checksumReader.Checksum()
+	}
 	if err != nil {
+		progress.finish(nil, err)
 		return nil, err
 	}
-	return H{
-		"PartNumber": int(partNumber),
-		"ETag":       etag,
-	}, nil
+	result := &UploadPartResult{
+		PartNumber: partNumber,
+		ETag:       etag,
+		Size:       size,
+		Checksum:   checksum,
+	}
+	progress.finish(result, nil)
+	return result, nil
+}
+
+func (b *baidu) MultipartUploadComplete(bucketName, region, objectKey, uploadId string, parts map[uint]string) (*CompleteResult, error) {
+	return b.MultipartUploadCompleteWithContext(context.Background(), bucketName, region, objectKey, uploadId, parts)
 }
 
-func (b *baidu) MultipartUploadComplete(bucketName, region, objectKey, uploadId string, parts map[uint]string) (H, error) {
+func (b *baidu) MultipartUploadCompleteWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string, parts map[uint]string) (*CompleteResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	bosClient, err := b.getBosNewClient(region)
 	if err != nil {
 		return nil, err
@@ -81,10 +252,397 @@ func (b *baidu) MultipartUploadComplete(bucketName, region, objectKey, uploadId
 	if err != nil {
 		return nil, err
 	}
-	return H{
-		"Location": result.Location,
-		"Bucket":   result.Bucket,
-		"ETag":     result.ETag,
-		"Key":      result.Key,
+	return &CompleteResult{
+		Bucket:   result.Bucket,
+		Key:      result.Key,
+		ETag:     result.ETag,
+		Location: result.Location,
+	}, nil
+}
+
+func (b *baidu) MultipartUploadAbort(bucketName, region, objectKey, uploadId string) error {
+	return b.MultipartUploadAbortWithContext(context.Background(), bucketName, region, objectKey, uploadId)
+}
+
+func (b *baidu) MultipartUploadAbortWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	bosClient, err := b.getBosNewClient(region)
+	if err != nil {
+		return err
+	}
+	return bosClient.AbortMultipartUpload(bucketName, objectKey, uploadId)
+}
+
+func (b *baidu) MultipartUploadListParts(bucketName, region, objectKey, uploadId string) ([]Part, error) {
+	return b.MultipartUploadListPartsWithContext(context.Background(), bucketName, region, objectKey, uploadId)
+}
+
+func (b *baidu) MultipartUploadListPartsWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string) ([]Part, error) {
+	bosClient, err := b.getBosNewClient(region)
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]Part, 0)
+	args := &api.ListPartsArgs{}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		result, err := bosClient.ListParts(bucketName, objectKey, uploadId, args)
+		if err != nil {
+			return nil, err
+		}
+		for _, part := range result.Parts {
+			parts = append(parts, Part{
+				PartNumber:   part.PartNumber,
+				ETag:         part.ETag,
+				Size:         int64(part.Size),
+				LastModified: parseISO8601(part.LastModified),
+			})
+		}
+		if !result.IsTruncated {
+			return parts, nil
+		}
+		args.PartNumberMarker = strconv.Itoa(result.NextPartNumberMarker)
+	}
+}
+
+func (b *baidu) ListMultipartUploads(bucketName, region, prefix, marker string, maxUploads int) (*MultipartUploadList, error) {
+	return b.ListMultipartUploadsWithContext(context.Background(), bucketName, region, prefix, marker, maxUploads)
+}
+
+func (b *baidu) ListMultipartUploadsWithContext(ctx context.Context, bucketName, region, prefix, marker string, maxUploads int) (*MultipartUploadList, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	// bos 只按 key 分页，没有 uploadIdMarker
+	keyMarker, _, err := decodeUploadMarker(marker)
+	if err != nil {
+		return nil, err
+	}
+	if maxUploads <= 0 {
+		maxUploads = defaultMaxUploads
+	}
+	bosClient, err := b.getBosNewClient(region)
+	if err != nil {
+		return nil, err
+	}
+	args := &api.ListMultipartUploadsArgs{
+		KeyMarker:  keyMarker,
+		MaxUploads: maxUploads,
+		Prefix:     prefix,
+	}
+	result, err := bosClient.ListMultipartUploads(bucketName, args)
+	if err != nil {
+		return nil, err
+	}
+	list := &MultipartUploadList{Uploads: make([]MultipartUpload, 0, len(result.Uploads))}
+	for _, upload := range result.Uploads {
+		list.Uploads = append(list.Uploads, MultipartUpload{
+			Key:       upload.Key,
+			UploadId:  upload.UploadId,
+			Initiated: parseISO8601(upload.Initiated),
+		})
+	}
+	if result.IsTruncated {
+		list.NextMarker = encodeUploadMarker(result.NextKeyMarker, "")
+	}
+	return list, nil
+}
+
+func (b *baidu) PutObject(bucketName, region, objectKey string, reader io.Reader, size int64, opts *PutObjectOptions) (*CompleteResult, error) {
+	return b.PutObjectWithContext(context.Background(), bucketName, region, objectKey, reader, size, opts)
+}
+
+func (b *baidu) PutObjectWithContext(ctx context.Context, bucketName, region, objectKey string, reader io.Reader, size int64, opts *PutObjectOptions) (*CompleteResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	bosClient, err := b.getBosNewClient(region)
+	if err != nil {
+		return nil, err
+	}
+	body, err := newBosBodyFromFile(reader, size)
+	if err != nil {
+		return nil, err
+	}
+	var etag string
+	if body != nil {
+		body.SetStream(ioutil.NopCloser(newContextReader(ctx, body.Stream())))
+		args := &api.PutObjectArgs{}
+		if opts != nil {
+			args.ContentType = opts.ContentType
+			args.UserMeta = opts.Metadata
+		}
+		etag, err = bosClient.PutObject(bucketName, objectKey, body, args)
+	} else {
+		headers := make(map[string]string)
+		if opts != nil {
+			if opts.ContentType != "" {
+				headers[bcehttp.CONTENT_TYPE] = opts.ContentType
+			}
+			for key, value := range opts.Metadata {
+				headers[bcehttp.BCE_USER_METADATA_PREFIX+key] = value
+			}
+		}
+		etag, err = b.putBosStream(region, bucketName, objectKey, nil, headers, newContextReader(ctx, reader), size)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &CompleteResult{
+		Bucket: bucketName,
+		Key:    objectKey,
+		ETag:   etag,
+	}, nil
+}
+
+func (b *baidu) GetObject(bucketName, region, objectKey string, opts *GetObjectOptions) (io.ReadCloser, error) {
+	return b.GetObjectWithContext(context.Background(), bucketName, region, objectKey, opts)
+}
+
+func (b *baidu) GetObjectWithContext(ctx context.Context, bucketName, region, objectKey string, opts *GetObjectOptions) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	bosClient, err := b.getBosNewClient(region)
+	if err != nil {
+		return nil, err
+	}
+	ranges := make([]int64, 0, 2)
+	if byteRange := opts.byteRange(); byteRange != nil {
+		ranges = append(ranges, byteRange.Start)
+		if byteRange.End >= 0 {
+			ranges = append(ranges, byteRange.End)
+		}
+	}
+	result, err := bosClient.GetObject(bucketName, objectKey, nil, ranges...)
+	if err != nil {
+		return nil, err
+	}
+	return newContextReadCloser(ctx, result.Body), nil
+}
+
+func (b *baidu) StatObject(bucketName, region, objectKey string) (*ObjectInfo, error) {
+	return b.StatObjectWithContext(context.Background(), bucketName, region, objectKey)
+}
+
+func (b *baidu) StatObjectWithContext(ctx context.Context, bucketName, region, objectKey string) (*ObjectInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	bosClient, err := b.getBosNewClient(region)
+	if err != nil {
+		return nil, err
+	}
+	result, err := bosClient.GetObjectMeta(bucketName, objectKey)
+	if err != nil {
+		var serviceErr *bce.BceServiceError
+		if errors.As(err, &serviceErr) && serviceErr.StatusCode == http.StatusNotFound {
+			return nil, wrapNotFound(err)
+		}
+		return nil, err
+	}
+	lastModified, _ := http.ParseTime(result.LastModified)
+	return &ObjectInfo{
+		Key:          objectKey,
+		Size:         result.ContentLength,
+		ETag:         result.ETag,
+		ContentType:  result.ContentType,
+		LastModified: lastModified,
+		Metadata:     normalizeMetadata(result.UserMeta),
+	}, nil
+}
+
+func (b *baidu) DeleteObject(bucketName, region, objectKey string) error {
+	return b.DeleteObjectWithContext(context.Background(), bucketName, region, objectKey)
+}
+
+func (b *baidu) DeleteObjectWithContext(ctx context.Context, bucketName, region, objectKey string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	bosClient, err := b.getBosNewClient(region)
+	if err != nil {
+		return err
+	}
+	err = bosClient.DeleteObject(bucketName, objectKey)
+	var serviceErr *bce.BceServiceError
+	if errors.As(err, &serviceErr) && serviceErr.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+func (b *baidu) DeleteObjects(bucketName, region string, objectKeys []string) ([]DeleteResult, error) {
+	return b.DeleteObjectsWithContext(context.Background(), bucketName, region, objectKeys)
+}
+
+func (b *baidu) DeleteObjectsWithContext(ctx context.Context, bucketName, region string, objectKeys []string) ([]DeleteResult, error) {
+	bosClient, err := b.getBosNewClient(region)
+	if err != nil {
+		return nil, err
+	}
+	failed := make(map[string]error)
+	for _, keys := range chunkKeys(objectKeys, maxDeleteObjects) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		result, err := bosClient.DeleteMultipleObjectsFromKeyList(bucketName, keys)
+		if err != nil {
+			return nil, err
+		}
+		for _, deleteErr := range result.Errors {
+			if deleteErr.Code == "NoSuchKey" {
+				continue
+			}
+			failed[deleteErr.Key] = fmt.Errorf("%s: %s", deleteErr.Code, deleteErr.Message)
+		}
+	}
+	return deleteResults(objectKeys, failed), nil
+}
+
+func (b *baidu) ListObjects(bucketName, region, prefix, delimiter, continuationToken string, maxKeys int) (*ObjectList, error) {
+	return b.ListObjectsWithContext(context.Background(), bucketName, region, prefix, delimiter, continuationToken, maxKeys)
+}
+
+// bos 使用 marker 分页，continuationToken 即为 marker
+func (b *baidu) ListObjectsWithContext(ctx context.Context, bucketName, region, prefix, delimiter, continuationToken string, maxKeys int) (*ObjectList, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	bosClient, err := b.getBosNewClient(region)
+	if err != nil {
+		return nil, err
+	}
+	if maxKeys <= 0 {
+		maxKeys = defaultMaxKeys
+	}
+	args := &api.ListObjectsArgs{
+		Delimiter: delimiter,
+		Marker:    continuationToken,
+		MaxKeys:   maxKeys,
+		Prefix:    prefix,
+	}
+	result, err := bosClient.ListObjects(bucketName, args)
+	if err != nil {
+		return nil, err
+	}
+	list := &ObjectList{
+		Objects:        make([]ObjectInfo, 0, len(result.Contents)),
+		CommonPrefixes: make([]string, 0, len(result.CommonPrefixes)),
+	}
+	for _, object := range result.Contents {
+		list.Objects = append(list.Objects, ObjectInfo{
+			Key:          object.Key,
+			Size:         int64(object.Size),
+			ETag:         object.ETag,
+			LastModified: parseISO8601(object.LastModified),
+		})
+	}
+	for _, commonPrefix := range result.CommonPrefixes {
+		list.CommonPrefixes = append(list.CommonPrefixes, commonPrefix.Prefix)
+	}
+	list.NextContinuationToken = nextListMarker(result.IsTruncated, result.NextMarker, list)
+	return list, nil
+}
+
+func (b *baidu) CopyObject(bucketName, region, objectKey, srcBucketName, srcObjectKey string) (*CompleteResult, error) {
+	return b.CopyObjectWithContext(context.Background(), bucketName, region, objectKey, srcBucketName, srcObjectKey)
+}
+
+func (b *baidu) CopyObjectWithContext(ctx context.Context, bucketName, region, objectKey, srcBucketName, srcObjectKey string) (*CompleteResult, error) {
+	srcInfo, err := b.StatObjectWithContext(ctx, srcBucketName, region, srcObjectKey)
+	if err != nil {
+		return nil, err
+	}
+	bosClient, err := b.getBosNewClient(region)
+	if err != nil {
+		return nil, err
+	}
+	if srcInfo.Size > maxCopyObjectSize {
+		return multipartCopy(ctx, b, bucketName, region, objectKey, srcInfo.Size, func(uploadId string, partNumber int, start, end int64) (string, error) {
+			if err := ctx.Err(); err != nil {
+				return "", err
+			}
+			args := &api.UploadPartCopyArgs{
+				SourceRange: fmt.Sprintf("bytes=%d-%d", start, end),
+			}
+			result, err := bosClient.UploadPartCopy(bucketName, objectKey, srcBucketName, srcObjectKey, uploadId, partNumber, args)
+			if err != nil {
+				return "", err
+			}
+			return result.ETag, nil
+		})
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	result, err := bosClient.BasicCopyObject(bucketName, objectKey, srcBucketName, srcObjectKey)
+	if err != nil {
+		return nil, err
+	}
+	return &CompleteResult{
+		Bucket: bucketName,
+		Key:    objectKey,
+		ETag:   result.ETag,
+	}, nil
+}
+
+func (b *baidu) PresignURL(method, bucketName, region, objectKey string, expiry time.Duration) (string, error) {
+	method, err := checkPresign(method, expiry)
+	if err != nil {
+		return "", err
+	}
+	bosClient, err := b.getBosNewClient(region)
+	if err != nil {
+		return "", err
+	}
+	return bosClient.GeneratePresignedUrl(bucketName, objectKey, int(expiry/time.Second), method, nil, nil), nil
+}
+
+// 分片的 ETag 在响应头 ETag 中，浏览器读取需要在 bucket 的 CORS 规则中暴露 ETag
+func (b *baidu) PresignMultipartUploadPart(bucketName, region, objectKey, uploadId string, partNumber uint, expiry time.Duration) (*PresignedPartRequest, error) {
+	if _, err := checkPresign(http.MethodPut, expiry); err != nil {
+		return nil, err
+	}
+	bosClient, err := b.getBosNewClient(region)
+	if err != nil {
+		return nil, err
+	}
+	expiration := time.Now().Add(expiry)
+	params := map[string]string{
+		"partNumber": strconv.Itoa(int(partNumber)),
+		"uploadId":   uploadId,
+	}
+	return &PresignedPartRequest{
+		PartNumber: partNumber,
+		Method:     http.MethodPut,
+		URL:        bosClient.GeneratePresignedUrl(bucketName, objectKey, int(expiry/time.Second), http.MethodPut, nil, params),
+		Header:     http.Header{},
+		Expiration: expiration,
+	}, nil
+}
+
+func (b *baidu) PresignPostPolicy(bucketName, region string, policy *PostPolicy) (*PostPolicyForm, error) {
+	if err := checkPostPolicy(policy); err != nil {
+		return nil, err
+	}
+	expiration := time.Now().Add(policy.Expiry)
+	document, err := marshalPostPolicy(expiration, policy.conditions(bucketName))
+	if err != nil {
+		return nil, err
+	}
+	encodedPolicy := base64.StdEncoding.EncodeToString(document)
+	fields := policy.formFields()
+	fields["accessKey"] = b.accessKey
+	fields["policy"] = encodedPolicy
+	fields["signature"] = hex.EncodeToString(hmacSHA256([]byte(b.secretKey), encodedPolicy))
+	return &PostPolicyForm{
+		URL:        b.getScheme("https") + "://" + bucketName + "." + b.getBosEndpoint(region),
+		Fields:     fields,
+		Expiration: expiration,
 	}, nil
 }
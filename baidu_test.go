@@ -0,0 +1,243 @@
+package go_cover_storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeBosRequest struct {
+	method, path, query string
+	header              http.Header
+	body                []byte
+}
+
+// 使用 bce 默认配置的客户端，请求发送到 handler
+func newBosClientWithHandler(handler http.HandlerFunc) (StoreClient, func()) {
+	server := httptest.NewServer(handler)
+	client := BaiduConfig{CloudConfig{AccessKey: testAccessKey, SecretKey: testSecretKey, Endpoint: strings.TrimPrefix(server.URL, "http://"), Region: "bj"}}.newClient()
+	return client, func() {
+		_ = client.Close()
+		server.Close()
+	}
+}
+
+// 记录收到的请求，前 failures 个请求返回 500
+func newFakeBosClient(t *testing.T, failures ...int) (StoreClient, *[]fakeBosRequest, func()) {
+	var mu sync.Mutex
+	requests := make([]fakeBosRequest, 0)
+	client, closeServer := newBosClientWithHandler(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, fakeBosRequest{r.Method, r.URL.Path, r.URL.RawQuery, r.Header, body})
+		failed := len(failures) > 0 && len(requests) <= failures[0]
+		mu.Unlock()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if failed {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("ETag", `"etag"`)
+	})
+	return client, &requests, closeServer
+}
+
+// io.SectionReader 等不是文件的 reader 直接作为请求体发送
+func TestBaiduUploadPartStreamsReader(t *testing.T) {
+	client, requests, closeServer := newFakeBosClient(t)
+	defer closeServer()
+	content := testContent(1000)
+	section := io.NewSectionReader(strings.NewReader(string(content)), 100, 500)
+	result, err := client.MultipartUploadPartFromReader("bucket", "", "key", "upload-1", 3, section, 500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := md5.Sum(content[100:600])
+	if result.ETag != "etag" || result.Size != 500 || result.Checksum != base64.StdEncoding.EncodeToString(sum[:]) {
+		t.Errorf("result = %+v", result)
+	}
+	if len(*requests) != 1 {
+		t.Fatalf("requests = %d", len(*requests))
+	}
+	req := (*requests)[0]
+	if req.method != http.MethodPut || req.path != "/bucket/key" || !strings.Contains(req.query, "partNumber=3") || !strings.Contains(req.query, "uploadId=upload-1") {
+		t.Errorf("request = %s %s?%s", req.method, req.path, req.query)
+	}
+	if string(req.body) != string(content[100:600]) {
+		t.Error("body does not match the section")
+	}
+	if req.header.Get("Authorization") == "" {
+		t.Error("request is not signed")
+	}
+}
+
+func TestBaiduPutObjectStreamsReader(t *testing.T) {
+	client, requests, closeServer := newFakeBosClient(t)
+	defer closeServer()
+	opts := &PutObjectOptions{ContentType: "text/plain", Metadata: map[string]string{"owner": "test"}}
+	if _, err := client.PutObject("bucket", "", "key", strings.NewReader("hello world"), 5, opts); err != nil {
+		t.Fatal(err)
+	}
+	req := (*requests)[0]
+	if string(req.body) != "hello" {
+		t.Errorf("body = %q", req.body)
+	}
+	if req.header.Get("Content-Type") != "text/plain" || req.header.Get("X-Bce-Meta-Owner") != "test" {
+		t.Errorf("header = %v", req.header)
+	}
+}
+
+func TestBaiduUploadPartShortReader(t *testing.T) {
+	client, _, closeServer := newFakeBosClient(t)
+	defer closeServer()
+	if _, err := client.MultipartUploadPartFromReader("bucket", "", "key", "upload-1", 1, strings.NewReader("short"), 100); err == nil {
+		t.Error("short reader should fail")
+	}
+}
+
+// 读取请求体时检查 ctx，取消后停止发送
+func TestBaiduUploadPartCanceled(t *testing.T) {
+	client, _, closeServer := newFakeBosClient(t)
+	defer closeServer()
+	ctx, cancel := context.WithCancel(context.Background())
+	reader := &cancelingReader{reader: strings.NewReader(strings.Repeat("a", 1<<20)), cancel: cancel}
+	_, err := client.MultipartUploadPartFromReaderWithContext(ctx, "bucket", "", "key", "upload-1", 1, reader, 1<<20)
+	if err == nil {
+		t.Error("canceled upload should fail")
+	}
+	if reader.reads > 2 {
+		t.Errorf("read %d times after cancel", reader.reads)
+	}
+}
+
+// bce 默认的重试策略会把请求体复制到内存中，数据流不能经过重试
+func TestBaiduStreamUploadNotBuffered(t *testing.T) {
+	client, closeServer := newBosClientWithHandler(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(ioutil.Discard, r.Body)
+		w.Header().Set("ETag", `"etag"`)
+	})
+	defer closeServer()
+	const size = 64 << 20
+	// 先发送一个小请求，排除创建客户端和连接的内存
+	if _, err := client.PutObject("bucket", "", "key", strings.NewReader("a"), 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	if _, err := client.MultipartUploadPartFromReader("bucket", "", "key", "upload-1", 1, &repeatReader{}, size); err != nil {
+		t.Fatal(err)
+	}
+	runtime.ReadMemStats(&after)
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > size/4 {
+		t.Errorf("allocated %d bytes to stream %d bytes", allocated, size)
+	}
+}
+
+// 数据流上传失败时由调用方重新上传，文件可以重新读取，仍然使用 bce 的重试
+func TestBaiduStreamUploadNotRetried(t *testing.T) {
+	client, requests, closeServer := newFakeBosClient(t, 1)
+	defer closeServer()
+	if _, err := client.MultipartUploadPartFromReader("bucket", "", "key", "upload-1", 1, strings.NewReader("hello"), 5); err == nil {
+		t.Fatal("failed stream upload should return an error")
+	}
+	if len(*requests) != 1 {
+		t.Errorf("stream requests = %d, want 1", len(*requests))
+	}
+
+	client, requests, closeServer = newFakeBosClient(t, 1)
+	defer closeServer()
+	file, err := ioutil.TempFile("", "bos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	if _, err = file.WriteString("hello"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.MultipartUploadPartFromReader("bucket", "", "key", "upload-1", 1, file, 5); err != nil {
+		t.Fatal(err)
+	}
+	if len(*requests) != 2 || string((*requests)[1].body) != "hello" {
+		t.Errorf("file requests = %+v", *requests)
+	}
+}
+
+// 管道不能 Seek，按数据流发送
+func TestBaiduUploadPartFromPipe(t *testing.T) {
+	client, requests, closeServer := newFakeBosClient(t)
+	defer closeServer()
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	go func() {
+		_, _ = writer.WriteString("hello world")
+		_ = writer.Close()
+	}()
+	if _, err = client.MultipartUploadPartFromReader("bucket", "", "key", "upload-1", 1, reader, 11); err != nil {
+		t.Fatal(err)
+	}
+	if len(*requests) != 1 || string((*requests)[0].body) != "hello world" {
+		t.Errorf("requests = %+v", *requests)
+	}
+}
+
+// 无限长的数据，读取时不分配内存
+type repeatReader struct{}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'a'
+	}
+	return len(p), nil
+}
+
+// 第一次读取后取消 ctx
+type cancelingReader struct {
+	reader io.Reader
+	cancel context.CancelFunc
+	reads  int
+}
+
+func (r *cancelingReader) Read(p []byte) (int, error) {
+	r.reads++
+	r.cancel()
+	if len(p) > 1024 {
+		p = p[:1024]
+	}
+	return r.reader.Read(p)
+}
+
+func TestBosTimeoutInMillis(t *testing.T) {
+	tests := map[time.Duration]int{
+		0:                       0,
+		300 * time.Millisecond:  1000,
+		time.Second:             1000,
+		1500 * time.Millisecond: 2000,
+		time.Minute:             60000,
+	}
+	for timeout, want := range tests {
+		if got := bosTimeoutInMillis(timeout); got != want {
+			t.Errorf("bosTimeoutInMillis(%v) = %d, want %d", timeout, got, want)
+		}
+	}
+}
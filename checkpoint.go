@@ -0,0 +1,197 @@
+package go_cover_storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 断点续传记录，UploadFile 上传大文件时保存在 Uploader.CheckpointDir 中，每个分片成功后更新
+// 中断后再次上传同一文件到同一对象时，使用记录中的 UploadId 继续，跳过云存储分片列表中已经存在的分片
+// 上传成功后删除记录，失败时保留记录和分片上传，用于下次继续
+type UploadCheckpoint struct {
+	// 源文件，任何一项变化后记录失效
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+
+	Bucket   string           `json:"bucket"`
+	Region   string           `json:"region"`
+	Key      string           `json:"key"`
+	UploadId string           `json:"uploadId"`
+	PartSize int64            `json:"partSize"`
+	Parts    []CheckpointPart `json:"parts"`
+}
+
+// 已上传的分片
+type CheckpointPart struct {
+	PartNumber uint   `json:"partNumber"`
+	ETag       string `json:"etag"`
+}
+
+// 断点文件名由源文件和目标对象决定
+func (u *Uploader) checkpointPath(sourcePath, bucketName, region, objectKey string) string {
+	sum := md5.Sum([]byte(strings.Join([]string{sourcePath, bucketName, region, objectKey}, "\n")))
+	return filepath.Join(u.CheckpointDir, hex.EncodeToString(sum[:])+".json")
+}
+
+// 读取断点记录，文件不存在或解析失败时返回 nil
+func readCheckpoint(filename string) *UploadCheckpoint {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil
+	}
+	checkpoint := &UploadCheckpoint{}
+	if err = json.Unmarshal(data, checkpoint); err != nil {
+		return nil
+	}
+	return checkpoint
+}
+
+// 先写入临时文件再重命名，进程中断时不会留下不完整的记录
+func (c *UploadCheckpoint) save(filename string) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return err
+	}
+	tempFile := filename + ".tmp"
+	if err = ioutil.WriteFile(tempFile, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tempFile, filename)
+}
+
+func (c *UploadCheckpoint) setParts(parts map[uint]string) {
+	c.Parts = make([]CheckpointPart, 0, len(parts))
+	for partNumber, eTag := range parts {
+		c.Parts = append(c.Parts, CheckpointPart{PartNumber: partNumber, ETag: eTag})
+	}
+	sort.Slice(c.Parts, func(i, j int) bool {
+		return c.Parts[i].PartNumber < c.Parts[j].PartNumber
+	})
+}
+
+// 分片编号对应的大小
+func (c *UploadCheckpoint) partLength(partNumber uint) int64 {
+	start := int64(partNumber-1) * c.PartSize
+	if start+c.PartSize > c.Size {
+		return c.Size - start
+	}
+	return c.PartSize
+}
+
+func (c *UploadCheckpoint) matches(other *UploadCheckpoint) bool {
+	return c.Path == other.Path && c.Size == other.Size && c.ModTime.Equal(other.ModTime) &&
+		c.Bucket == other.Bucket && c.Region == other.Region && c.Key == other.Key
+}
+
+// 使用云存储的分片列表校验断点记录，返回确认已上传的分片
+// 记录中没有但列表中大小正确的分片也视为已上传，进程可能在上传成功后、保存记录前中断
+// 分片上传已经不存在时返回 ErrNoSuchUpload
+func (u *Uploader) verifyCheckpoint(ctx context.Context, checkpoint *UploadCheckpoint) (map[uint]string, error) {
+	listed, err := u.Client.MultipartUploadListPartsWithContext(ctx, checkpoint.Bucket, checkpoint.Region, checkpoint.Key, checkpoint.UploadId)
+	if err != nil {
+		return nil, err
+	}
+	recorded := make(map[uint]string, len(checkpoint.Parts))
+	for _, part := range checkpoint.Parts {
+		recorded[part.PartNumber] = part.ETag
+	}
+	partCount := uint((checkpoint.Size + checkpoint.PartSize - 1) / checkpoint.PartSize)
+	parts := make(map[uint]string)
+	for _, part := range listed {
+		partNumber := uint(part.PartNumber)
+		if partNumber < 1 || partNumber > partCount || part.Size != checkpoint.partLength(partNumber) {
+			continue
+		}
+		eTag := part.ETag
+		if recordedETag, ok := recorded[partNumber]; ok && strings.Trim(recordedETag, `"`) == strings.Trim(eTag, `"`) {
+			eTag = recordedETag
+		}
+		parts[partNumber] = eTag
+	}
+	return parts, nil
+}
+
+// 使用断点记录上传文件
+func (u *Uploader) uploadFileWithCheckpoint(ctx context.Context, bucketName, region, objectKey string, file *os.File, info os.FileInfo, opts *PutObjectOptions) (*CompleteResult, error) {
+	if hasPutObjectOptions(opts) {
+		return nil, ErrMultipartUploadOptions
+	}
+	sourcePath, err := filepath.Abs(file.Name())
+	if err != nil {
+		return nil, err
+	}
+	checkpointPath := u.checkpointPath(sourcePath, bucketName, region, objectKey)
+	ctx, progress := u.withProgress(ctx, info.Size())
+	checkpoint := &UploadCheckpoint{
+		Path:     sourcePath,
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+		Bucket:   bucketName,
+		Region:   region,
+		Key:      objectKey,
+		PartSize: u.partSize(info.Size()),
+	}
+	var parts map[uint]string
+	if saved := readCheckpoint(checkpointPath); saved != nil && saved.UploadId != "" && saved.PartSize > 0 {
+		if saved.matches(checkpoint) {
+			parts, err = u.verifyCheckpoint(ctx, saved)
+			if err != nil && !errors.Is(err, ErrNoSuchUpload) {
+				return nil, err
+			}
+			if err == nil {
+				checkpoint = saved
+			}
+		} else {
+			// 源文件已经变化，之前的分片不能再用
+			_ = u.Client.MultipartUploadAbortWithContext(ctx, saved.Bucket, saved.Region, saved.Key, saved.UploadId)
+		}
+	}
+	if checkpoint.UploadId == "" {
+		if checkpoint.UploadId, err = u.Client.MultipartUploadInitWithContext(ctx, bucketName, region, objectKey); err != nil {
+			return nil, err
+		}
+		parts = make(map[uint]string)
+	}
+	checkpoint.setParts(parts)
+	if err = checkpoint.save(checkpointPath); err != nil {
+		return nil, err
+	}
+
+	skip := make(map[uint]bool, len(parts))
+	for partNumber := range parts {
+		skip[partNumber] = true
+		progress.skip(checkpoint.partLength(partNumber))
+	}
+	partDone := func() error {
+		checkpoint.setParts(parts)
+		return checkpoint.save(checkpointPath)
+	}
+	produce := readerAtParts(0, checkpoint.Size, checkpoint.PartSize, skip)
+	if err = u.uploadParts(ctx, bucketName, region, objectKey, checkpoint.UploadId, file, parts, partDone, produce); err != nil {
+		return nil, err
+	}
+	result, err := u.Client.MultipartUploadCompleteWithContext(ctx, bucketName, region, objectKey, checkpoint.UploadId, parts)
+	if err != nil {
+		// 分片上传已经失效，下次重新开始
+		if errors.Is(err, ErrNoSuchUpload) || errors.Is(err, ErrInvalidPart) {
+			_ = os.Remove(checkpointPath)
+			_ = u.abortMultipart(bucketName, region, objectKey, checkpoint.UploadId)
+		}
+		return nil, err
+	}
+	_ = os.Remove(checkpointPath)
+	return result, nil
+}
@@ -0,0 +1,113 @@
+package go_cover_storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 前 succeed 个分片上传成功，之后的分片返回不可重试的错误
+type interruptingClient struct {
+	StoreClient
+	succeed  int32
+	attempts int32
+}
+
+func (c *interruptingClient) MultipartUploadPartFromReaderWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string, partNumber uint, reader io.Reader, size int64) (*UploadPartResult, error) {
+	if atomic.AddInt32(&c.attempts, 1) > c.succeed {
+		return nil, &StorageError{Kind: ErrAccessDenied, Err: errors.New("denied")}
+	}
+	return c.StoreClient.MultipartUploadPartFromReaderWithContext(ctx, bucketName, region, objectKey, uploadId, partNumber, reader, size)
+}
+
+func writeTestFile(t *testing.T, dir string, content []byte) string {
+	t.Helper()
+	filename := filepath.Join(dir, "source")
+	if err := ioutil.WriteFile(filename, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func checkpointFiles(t *testing.T, dir string) []os.FileInfo {
+	t.Helper()
+	files, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// 断点续传同样不能静默丢弃 ContentType 和 Metadata
+func TestUploadFileWithCheckpointRejectsOptions(t *testing.T) {
+	client, cleanup := newTestLocalClient(t)
+	defer cleanup()
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := writeTestFile(t, dir, testContent(6<<20))
+	checkpointDir := filepath.Join(dir, "checkpoints")
+	uploader := &Uploader{Client: client, PartSize: minUploadPartSize, CheckpointDir: checkpointDir}
+
+	opts := &PutObjectOptions{Metadata: map[string]string{"owner": "test"}}
+	if _, err := uploader.UploadFile(context.Background(), "bucket", "", "file", filename, opts); !errors.Is(err, ErrMultipartUploadOptions) {
+		t.Fatalf("err = %v, want ErrMultipartUploadOptions", err)
+	}
+	if files := checkpointFiles(t, checkpointDir); len(files) != 0 {
+		t.Errorf("checkpoint saved for rejected upload: %d files", len(files))
+	}
+	checkNoUploads(t, client)
+
+	// 小文件直接上传，可以设置 opts
+	small := writeTestFile(t, dir, testContent(10))
+	if _, err := uploader.UploadFile(context.Background(), "bucket", "", "small", small, opts); err != nil {
+		t.Errorf("small file = %v", err)
+	}
+}
+
+func TestUploadFileWithCheckpointResume(t *testing.T) {
+	client, cleanup := newTestLocalClient(t)
+	defer cleanup()
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	content := testContent(12 << 20)
+	filename := writeTestFile(t, dir, content)
+	checkpointDir := filepath.Join(dir, "checkpoints")
+
+	// 第一个分片成功后中断
+	interrupted := &interruptingClient{StoreClient: client, succeed: 1}
+	uploader := &Uploader{Client: interrupted, PartSize: minUploadPartSize, Concurrency: 1, CheckpointDir: checkpointDir, RetryDelay: time.Millisecond}
+	if _, err := uploader.UploadFile(context.Background(), "bucket", "", "file", filename, nil); err == nil {
+		t.Fatal("interrupted upload succeeded")
+	}
+	if files := checkpointFiles(t, checkpointDir); len(files) != 1 {
+		t.Fatalf("checkpoint files = %d, want 1", len(files))
+	}
+
+	counting := &flakyClient{StoreClient: client}
+	uploader.Client = counting
+	if _, err := uploader.UploadFile(context.Background(), "bucket", "", "file", filename, nil); err != nil {
+		t.Fatal(err)
+	}
+	if counting.attempts != 2 {
+		t.Errorf("resumed upload sent %d parts, want 2", counting.attempts)
+	}
+	if string(readObject(t, client, "file")) != string(content) {
+		t.Error("uploaded content does not match")
+	}
+	if files := checkpointFiles(t, checkpointDir); len(files) != 0 {
+		t.Errorf("checkpoint left after upload: %d files", len(files))
+	}
+	checkNoUploads(t, client)
+}
@@ -0,0 +1,87 @@
+package go_cover_storage
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// 按 key 缓存各云存储的 SDK 客户端、连接和七牛空间的机房信息，并发安全
+// 同一个 key 只创建一次，创建失败不缓存，下次调用重新创建
+// 值为 nil 的 *clientCache 不缓存，每次都调用 create
+type clientCache struct {
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	once  sync.Once
+	value interface{}
+	err   error
+}
+
+// 实现了该接口的缓存值在 Close 时释放空闲连接
+type idleConnectionsCloser interface {
+	CloseIdleConnections()
+}
+
+func newClientCache() *clientCache {
+	return &clientCache{entries: make(map[string]*cacheEntry)}
+}
+
+// 缓存 key，各部分不能包含 |
+func cacheKey(parts ...string) string {
+	return strings.Join(parts, "|")
+}
+
+func (c *clientCache) get(key string, create func() (interface{}, error)) (interface{}, error) {
+	if c == nil {
+		return create()
+	}
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &cacheEntry{}
+		c.entries[key] = entry
+	}
+	c.mu.Unlock()
+	// 同一个 key 并发调用时只创建一次，不持有 mu，不同 key 的创建互不阻塞
+	entry.once.Do(func() {
+		entry.value, entry.err = create()
+	})
+	if entry.err != nil {
+		c.mu.Lock()
+		if c.entries[key] == entry {
+			delete(c.entries, key)
+		}
+		c.mu.Unlock()
+		return nil, entry.err
+	}
+	return entry.value, nil
+}
+
+// 清空缓存并释放空闲连接，之后再调用会重新创建
+func (c *clientCache) close() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	entries := c.entries
+	c.entries = make(map[string]*cacheEntry)
+	c.mu.Unlock()
+	for _, entry := range entries {
+		// 等待正在进行的创建完成
+		entry.once.Do(func() {})
+		if closer, ok := entry.value.(idleConnectionsCloser); ok {
+			closer.CloseIdleConnections()
+		}
+	}
+}
+
+// 每个客户端单独的连接池，Close 时释放空闲连接
+func (c *clientCache) transport() *http.Transport {
+	value, _ := c.get("transport", func() (interface{}, error) {
+		return http.DefaultTransport.(*http.Transport).Clone(), nil
+	})
+	return value.(*http.Transport)
+}
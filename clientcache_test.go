@@ -0,0 +1,136 @@
+package go_cover_storage
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestClientCacheGetCreatesOnce(t *testing.T) {
+	cache := newClientCache()
+	var created int32
+	var wg sync.WaitGroup
+	values := make([]interface{}, 32)
+	for i := range values {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			values[i], _ = cache.get("key", func() (interface{}, error) {
+				atomic.AddInt32(&created, 1)
+				return new(int), nil
+			})
+		}(i)
+	}
+	wg.Wait()
+	if created != 1 {
+		t.Fatalf("created %d times, want 1", created)
+	}
+	for _, value := range values {
+		if value != values[0] {
+			t.Fatal("concurrent get returned different values")
+		}
+	}
+}
+
+func TestClientCacheCloseEvicts(t *testing.T) {
+	cache := newClientCache()
+	transport := cache.transport()
+	if cache.transport() != transport {
+		t.Fatal("transport should be cached")
+	}
+	first, _ := cache.get("key", func() (interface{}, error) { return new(int), nil })
+	cache.close()
+	if len(cache.entries) != 0 {
+		t.Fatalf("entries = %d after close", len(cache.entries))
+	}
+	second, _ := cache.get("key", func() (interface{}, error) { return new(int), nil })
+	if first == second {
+		t.Error("get after close should create a new value")
+	}
+	if cache.transport() == transport {
+		t.Error("transport after close should be recreated")
+	}
+}
+
+func TestClientCacheErrorNotCached(t *testing.T) {
+	cache := newClientCache()
+	errCreate := errors.New("create failed")
+	if _, err := cache.get("key", func() (interface{}, error) { return nil, errCreate }); err != errCreate {
+		t.Fatalf("err = %v", err)
+	}
+	value, err := cache.get("key", func() (interface{}, error) { return 1, nil })
+	if err != nil || value != 1 {
+		t.Fatalf("value = %v, err = %v", value, err)
+	}
+}
+
+func TestNilClientCache(t *testing.T) {
+	var cache *clientCache
+	var created int
+	for i := 0; i < 2; i++ {
+		_, _ = cache.get("key", func() (interface{}, error) {
+			created++
+			return nil, nil
+		})
+	}
+	if created != 2 {
+		t.Errorf("created %d times, want 2", created)
+	}
+	cache.close()
+}
+
+// 指定机房时不请求网络，不同机房分别缓存
+func TestQiniuCacheKeyIncludesRegion(t *testing.T) {
+	q := QiniuConfig{CloudConfig: CloudConfig{AccessKey: testAccessKey, SecretKey: testSecretKey}}.newClient().(*qiniu)
+	defer q.Close()
+	east, err := q.getKodoConfig("bucket", "z0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	north, err := q.getKodoConfig("bucket", "z1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if east.Region.SrcUpHosts[0] == north.Region.SrcUpHosts[0] {
+		t.Fatalf("z0 and z1 share up host %s", east.Region.SrcUpHosts[0])
+	}
+	_, eastUpHost, _, err := q.getKodoResumeUploaderV2("bucket", "z0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, northUpHost, _, err := q.getKodoResumeUploaderV2("bucket", "z1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eastUpHost == northUpHost {
+		t.Fatalf("z0 and z1 share up host %s", eastUpHost)
+	}
+	again, _ := q.getKodoConfig("bucket", "z0")
+	if again.Region != east.Region {
+		t.Error("region should be cached")
+	}
+}
+
+// 查询到的下载域名按空间缓存，Close 后清空
+func TestQiniuDownloadDomainCached(t *testing.T) {
+	q := QiniuConfig{CloudConfig: CloudConfig{AccessKey: testAccessKey, SecretKey: testSecretKey}}.newClient().(*qiniu)
+	var lookups int32
+	_, _ = q.cache.get(cacheKey("domain", "bucket"), func() (interface{}, error) {
+		atomic.AddInt32(&lookups, 1)
+		return "dl.example.com", nil
+	})
+	for i := 0; i < 3; i++ {
+		domain, err := q.getDownloadDomain("bucket", "z0")
+		if err != nil || domain != "dl.example.com" {
+			t.Fatalf("domain = %s, err = %v", domain, err)
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("looked up %d times, want 1", lookups)
+	}
+	_ = q.Close()
+	if len(q.cache.entries) != 0 {
+		t.Errorf("entries = %d after Close", len(q.cache.entries))
+	}
+}
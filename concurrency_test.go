@@ -0,0 +1,221 @@
+package go_cover_storage
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 这些测试需要使用 go test -race 运行才能发现数据竞争
+
+// 同时创建多个租户的客户端，每个客户端签名时只能使用自己的密钥
+func TestConcurrentClientsDoNotShareCredentials(t *testing.T) {
+	const tenants = 8
+	providers := []string{"aliyun", "baidu", "huawei", "qiniu", "tencent"}
+	var wg sync.WaitGroup
+	for _, provider := range providers {
+		for i := 0; i < tenants; i++ {
+			wg.Add(1)
+			go func(provider string, i int) {
+				defer wg.Done()
+				accessKey := fmt.Sprintf("AK%s%dX", provider, i)
+				appId := fmt.Sprintf("12500000%02d", i)
+				options := map[string]interface{}{
+					"accessKey":      accessKey,
+					"secretKey":      fmt.Sprintf("SK%s%dX", provider, i),
+					"region":         "cn-north-1",
+					"appId":          appId,
+					"downloadDomain": fmt.Sprintf("dl%d.example.com", i),
+				}
+				var client StoreClient
+				var err error
+				// 一半使用 CreateClient，一半使用 NewClient
+				if i%2 == 0 {
+					client, err = CreateClient(provider, options)
+				} else {
+					var cfg Config
+					if cfg, err = decodeConfig(provider, options, false); err == nil {
+						client, err = NewClient(cfg)
+					}
+				}
+				if err != nil {
+					t.Errorf("%s tenant %d: %v", provider, i, err)
+					return
+				}
+				defer client.Close()
+				for j := 0; j < 20; j++ {
+					presignedURL, err := client.PresignURL("GET", "bucket", "", fmt.Sprintf("key-%d", j), time.Hour)
+					if err != nil {
+						t.Errorf("%s tenant %d: %v", provider, i, err)
+						return
+					}
+					decoded, _ := url.QueryUnescape(presignedURL)
+					if !strings.Contains(decoded, accessKey) {
+						t.Errorf("%s tenant %d signed with another access key: %s", provider, i, presignedURL)
+						return
+					}
+					if provider == "tencent" && !strings.Contains(presignedURL, "bucket-"+appId+".") {
+						t.Errorf("tencent tenant %d used another appId: %s", i, presignedURL)
+						return
+					}
+				}
+			}(provider, i)
+		}
+	}
+	wg.Wait()
+}
+
+// 同时使用多个本地存储客户端，文件只能写入各自的目录
+func TestConcurrentLocalClients(t *testing.T) {
+	const tenants = 4
+	dir, err := ioutil.TempDir("", "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var wg sync.WaitGroup
+	for i := 0; i < tenants; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tenantDir := filepath.Join(dir, fmt.Sprint(i))
+			client, err := CreateClient("local", map[string]interface{}{
+				"tempDir":    filepath.Join(tenantDir, "temp"),
+				"storageDir": filepath.Join(tenantDir, "storage"),
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer client.Close()
+			var clientWG sync.WaitGroup
+			for j := 0; j < 8; j++ {
+				clientWG.Add(1)
+				go func(j int) {
+					defer clientWG.Done()
+					key := fmt.Sprintf("dir/%d-%d", i, j)
+					content := []byte(key)
+					if _, err := client.PutObject("bucket", "", key, bytes.NewReader(content), int64(len(content)), nil); err != nil {
+						t.Error(err)
+						return
+					}
+					if _, err := client.StatObject("bucket", "", key); err != nil {
+						t.Error(err)
+					}
+				}(j)
+			}
+			clientWG.Wait()
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < tenants; i++ {
+		files, err := ioutil.ReadDir(filepath.Join(dir, fmt.Sprint(i), "storage", "bucket", "dir"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != 8 {
+			t.Errorf("tenant %d has %d objects, want 8", i, len(files))
+		}
+		for _, file := range files {
+			if !strings.HasPrefix(file.Name(), fmt.Sprintf("%d-", i)) {
+				t.Errorf("tenant %d has object %s of another tenant", i, file.Name())
+			}
+		}
+	}
+}
+
+// 多个分片上传同时进行，同一个分片上传的分片也并发上传
+func TestConcurrentLocalMultipartUpload(t *testing.T) {
+	client, cleanup := newTestLocalClient(t)
+	defer cleanup()
+	const uploads, partCount = 4, 6
+	var wg sync.WaitGroup
+	for i := 0; i < uploads; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("multipart-%d", i)
+			uploadId, err := client.MultipartUploadInit("bucket", "", key)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			var mu sync.Mutex
+			parts := make(map[uint]string, partCount)
+			var partWG sync.WaitGroup
+			for partNumber := uint(1); partNumber <= partCount; partNumber++ {
+				partWG.Add(1)
+				go func(partNumber uint) {
+					defer partWG.Done()
+					body := []byte(fmt.Sprintf("%s-part-%d;", key, partNumber))
+					result, err := client.MultipartUploadPart("bucket", "", key, uploadId, partNumber, body)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					mu.Lock()
+					parts[partNumber] = result.ETag
+					mu.Unlock()
+				}(partNumber)
+			}
+			partWG.Wait()
+			if _, err := client.MultipartUploadComplete("bucket", "", key, uploadId, parts); err != nil {
+				t.Error(err)
+				return
+			}
+			var want strings.Builder
+			for partNumber := 1; partNumber <= partCount; partNumber++ {
+				fmt.Fprintf(&want, "%s-part-%d;", key, partNumber)
+			}
+			body, err := client.GetObject("bucket", "", key, nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer body.Close()
+			if got, err := ioutil.ReadAll(body); err != nil || string(got) != want.String() {
+				t.Errorf("%s = %q, %v, want %q", key, got, err, want.String())
+			}
+		}(i)
+	}
+	wg.Wait()
+	checkNoUploads(t, client)
+}
+
+// 并发 get 的同时 close，close 之后的 get 重新创建
+func TestConcurrentClientCacheClose(t *testing.T) {
+	cache := newClientCache()
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				key := cacheKey("key", fmt.Sprint(j%4))
+				value, err := cache.get(key, func() (interface{}, error) {
+					return key, nil
+				})
+				if err != nil || value != key {
+					t.Errorf("get %s = %v, %v", key, value, err)
+					return
+				}
+				if cache.transport() == nil {
+					t.Error("transport is nil")
+					return
+				}
+				if i%4 == 0 && j%10 == 0 {
+					cache.close()
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	cache.close()
+}
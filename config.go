@@ -0,0 +1,408 @@
+package go_cover_storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 云存储客户端配置，由 NewClient 校验后创建客户端
+// 只有本包中的配置类型能实现该接口，其他云存储通过 RegisterProvider 注册后使用 CreateClient 创建
+type Config interface {
+	// 云存储名称，与 CreateClient 的 clientName 相同
+	Provider() string
+	Validate() error
+	newClient() StoreClient
+}
+
+// 云存储通用配置
+type CloudConfig struct {
+	AccessKey string
+	SecretKey string
+	// 自定义访问域名，不带 scheme，为空时根据 region 生成
+	Endpoint string
+	// http 或 https，为空时使用各云存储原有的默认值
+	Scheme string
+	// 单次请求的超时时间，包括读取响应，0 表示不限制
+	Timeout time.Duration
+	// 调用方法时 region 为空使用的默认地域
+	Region string
+}
+
+type AliyunConfig struct {
+	CloudConfig
+}
+
+type BaiduConfig struct {
+	CloudConfig
+}
+
+type HuaweiConfig struct {
+	CloudConfig
+}
+
+// 七牛根据空间自动选择机房，不支持自定义 Endpoint
+type QiniuConfig struct {
+	CloudConfig
+	// 下载和预签名链接使用的域名，不带 scheme，为空时使用空间绑定的第一个域名
+	DownloadDomain string
+}
+
+type TencentConfig struct {
+	CloudConfig
+	AppId string
+}
+
+type LocalConfig struct {
+	TempDir    string
+	StorageDir string
+}
+
+var (
+	ErrEmptyConfig     = errors.New("config cannot be empty")
+	ErrInvalidScheme   = errors.New("scheme must be http or https")
+	ErrInvalidEndpoint = errors.New("endpoint must be a host without scheme or path")
+	ErrInvalidTimeout  = errors.New("timeout cannot be negative")
+	ErrUnknownOption   = errors.New("unknown option")
+)
+
+// 校验配置并创建客户端，客户端方法返回的错误都是 *StorageError
+func NewClient(cfg Config) (StoreClient, error) {
+	if cfg == nil {
+		return nil, ErrEmptyConfig
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return newErrorClient(cfg.Provider(), cfg.newClient()), nil
+}
+
+func (c CloudConfig) Validate() error {
+	if strings.TrimSpace(c.AccessKey) == "" {
+		return ErrEmptyAccessKey
+	}
+	if strings.TrimSpace(c.SecretKey) == "" {
+		return ErrEmptySecretKey
+	}
+	if c.Endpoint != "" && strings.ContainsAny(c.Endpoint, "/?#") {
+		return fmt.Errorf("%w: %s", ErrInvalidEndpoint, c.Endpoint)
+	}
+	if c.Scheme != "" && c.Scheme != "http" && c.Scheme != "https" {
+		return fmt.Errorf("%w: %s", ErrInvalidScheme, c.Scheme)
+	}
+	if c.Timeout < 0 {
+		return ErrInvalidTimeout
+	}
+	return nil
+}
+
+func (c CloudConfig) connOptions() connOptions {
+	return connOptions{
+		endpoint: strings.TrimSpace(c.Endpoint),
+		scheme:   c.Scheme,
+		timeout:  c.Timeout,
+		region:   strings.TrimSpace(c.Region),
+	}
+}
+
+func (c AliyunConfig) Provider() string {
+	return "aliyun"
+}
+
+func (c AliyunConfig) newClient() StoreClient {
+	return &aliyun{
+		accessKeyId:     strings.TrimSpace(c.AccessKey),
+		accessKeySecret: strings.TrimSpace(c.SecretKey),
+		connOptions:     c.connOptions(),
+		cache:           newClientCache(),
+	}
+}
+
+func (c BaiduConfig) Provider() string {
+	return "baidu"
+}
+
+func (c BaiduConfig) newClient() StoreClient {
+	return &baidu{
+		accessKey:   strings.TrimSpace(c.AccessKey),
+		secretKey:   strings.TrimSpace(c.SecretKey),
+		connOptions: c.connOptions(),
+		cache:       newClientCache(),
+	}
+}
+
+func (c HuaweiConfig) Provider() string {
+	return "huawei"
+}
+
+func (c HuaweiConfig) newClient() StoreClient {
+	return &huawei{
+		accessKey:   strings.TrimSpace(c.AccessKey),
+		secretKey:   strings.TrimSpace(c.SecretKey),
+		connOptions: c.connOptions(),
+		cache:       newClientCache(),
+	}
+}
+
+func (c QiniuConfig) Provider() string {
+	return "qiniu"
+}
+
+func (c QiniuConfig) Validate() error {
+	if c.Endpoint != "" {
+		return fmt.Errorf("%w: qiniu does not support custom endpoint", ErrInvalidEndpoint)
+	}
+	if strings.ContainsAny(c.DownloadDomain, "/?#") {
+		return fmt.Errorf("%w: %s", ErrInvalidEndpoint, c.DownloadDomain)
+	}
+	return c.CloudConfig.Validate()
+}
+
+func (c QiniuConfig) newClient() StoreClient {
+	return &qiniu{
+		accessKey:      strings.TrimSpace(c.AccessKey),
+		secretKey:      strings.TrimSpace(c.SecretKey),
+		downloadDomain: strings.TrimSpace(c.DownloadDomain),
+		connOptions:    c.connOptions(),
+		cache:          newClientCache(),
+	}
+}
+
+func (c TencentConfig) Provider() string {
+	return "tencent"
+}
+
+func (c TencentConfig) Validate() error {
+	if strings.TrimSpace(c.AppId) == "" {
+		return ErrEmptyAppId
+	}
+	return c.CloudConfig.Validate()
+}
+
+func (c TencentConfig) newClient() StoreClient {
+	return &tencent{
+		appId:       strings.TrimSpace(c.AppId),
+		secretId:    strings.TrimSpace(c.AccessKey),
+		secretKey:   strings.TrimSpace(c.SecretKey),
+		connOptions: c.connOptions(),
+		cache:       newClientCache(),
+	}
+}
+
+func (c LocalConfig) Provider() string {
+	return "local"
+}
+
+func (c LocalConfig) Validate() error {
+	if strings.TrimSpace(c.TempDir) == "" {
+		return ErrEmptyTempDir
+	}
+	if strings.TrimSpace(c.StorageDir) == "" {
+		return ErrEmptyStorageDir
+	}
+	return nil
+}
+
+// 目录在创建时处理好，之后客户端不再修改，可以在多个 goroutine 中使用
+func (c LocalConfig) newClient() StoreClient {
+	return &local{
+		tempDir:    safetyPath(strings.TrimSpace(c.TempDir)),
+		storageDir: safetyPath(strings.TrimSpace(c.StorageDir)),
+	}
+}
+
+// 把 CreateClient 使用的 options 转换为对应云存储的配置，不认识的 key 会返回 ErrUnknownOption，避免拼写错误的配置不生效
+// CreateClient 与以前一样忽略不认识的 key
+// 支持的 key：accessKey、secretKey、endpoint、scheme、timeout、region，腾讯云的 appId，七牛的 downloadDomain，本地存储的 tempDir、storageDir
+// timeout 可以是 time.Duration、秒数或 time.ParseDuration 支持的字符串
+func DecodeConfig(clientName string, options map[string]interface{}) (Config, error) {
+	return decodeConfig(clientName, options, true)
+}
+
+// strict 为 false 时忽略不认识的 key
+func decodeConfig(clientName string, options map[string]interface{}, strict bool) (Config, error) {
+	decoder := &optionDecoder{
+		options: options,
+		used:    make(map[string]bool),
+	}
+	var cfg Config
+	var err error
+	switch clientName {
+	case "aliyun":
+		c := AliyunConfig{}
+		c.CloudConfig, err = decoder.cloudConfig()
+		cfg = c
+	case "baidu":
+		c := BaiduConfig{}
+		c.CloudConfig, err = decoder.cloudConfig()
+		cfg = c
+	case "huawei":
+		c := HuaweiConfig{}
+		c.CloudConfig, err = decoder.cloudConfig()
+		cfg = c
+	case "qiniu":
+		c := QiniuConfig{}
+		if c.CloudConfig, err = decoder.cloudConfig(); err == nil {
+			c.DownloadDomain, err = decoder.optionalString("downloadDomain")
+		}
+		cfg = c
+	case "tencent":
+		c := TencentConfig{}
+		if c.AppId, err = decoder.requiredString("appId", ErrEmptyAppId, ErrStringAppId); err == nil {
+			c.CloudConfig, err = decoder.cloudConfig()
+		}
+		cfg = c
+	case "local":
+		c := LocalConfig{}
+		if c.TempDir, err = decoder.requiredString("tempDir", ErrEmptyTempDir, ErrStringTempDir); err == nil {
+			c.StorageDir, err = decoder.requiredString("storageDir", ErrEmptyStorageDir, ErrStringStorageDir)
+		}
+		cfg = c
+	default:
+		return nil, fmt.Errorf("client %s not exist", clientName)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if strict {
+		if err = decoder.checkUnknown(); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// 按 options 初始化客户端，各云存储的 Init 使用，兼容以前的 options，不检查多余的 key
+func initClient(clientName string, options map[string]interface{}) (StoreClient, error) {
+	cfg, err := decodeConfig(clientName, options, false)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(cfg)
+}
+
+// 读取 options 并记录用到的 key
+type optionDecoder struct {
+	options map[string]interface{}
+	used    map[string]bool
+}
+
+func (d *optionDecoder) requiredString(key string, errEmpty, errString error) (string, error) {
+	d.used[key] = true
+	return checkCommonStringKey(key, d.options, errEmpty, errString)
+}
+
+func (d *optionDecoder) optionalString(key string) (string, error) {
+	d.used[key] = true
+	data, ok := d.options[key]
+	if !ok || data == nil {
+		return "", nil
+	}
+	stringData, ok := optionString(data)
+	if !ok {
+		return "", fmt.Errorf("%s is not a string", key)
+	}
+	return strings.TrimSpace(stringData), nil
+}
+
+func (d *optionDecoder) duration(key string) (time.Duration, error) {
+	d.used[key] = true
+	data, ok := d.options[key]
+	if !ok || data == nil {
+		return 0, nil
+	}
+	switch value := data.(type) {
+	case time.Duration:
+		return value, nil
+	case int:
+		return time.Duration(value) * time.Second, nil
+	case int64:
+		return time.Duration(value) * time.Second, nil
+	case float64:
+		return time.Duration(value * float64(time.Second)), nil
+	case json.Number:
+		seconds, err := value.Float64()
+		if err != nil {
+			return 0, fmt.Errorf("%s is not a valid duration: %w", key, err)
+		}
+		return time.Duration(seconds * float64(time.Second)), nil
+	case string:
+		duration, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return 0, fmt.Errorf("%s is not a valid duration: %w", key, err)
+		}
+		return duration, nil
+	}
+	return 0, fmt.Errorf("%s is not a valid duration", key)
+}
+
+func (d *optionDecoder) cloudConfig() (CloudConfig, error) {
+	cfg := CloudConfig{}
+	var err error
+	if cfg.AccessKey, cfg.SecretKey, err = getAccessKeySecretKey(d.options); err != nil {
+		return cfg, err
+	}
+	d.used["accessKey"] = true
+	d.used["secretKey"] = true
+	if cfg.Endpoint, err = d.optionalString("endpoint"); err != nil {
+		return cfg, err
+	}
+	if cfg.Scheme, err = d.optionalString("scheme"); err != nil {
+		return cfg, err
+	}
+	if cfg.Region, err = d.optionalString("region"); err != nil {
+		return cfg, err
+	}
+	if cfg.Timeout, err = d.duration("timeout"); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+func (d *optionDecoder) checkUnknown() error {
+	unknown := make([]string, 0)
+	for key := range d.options {
+		if !d.used[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("%w: %s", ErrUnknownOption, strings.Join(unknown, ", "))
+}
+
+// 各云存储客户端共用的连接配置
+type connOptions struct {
+	endpoint string
+	scheme   string
+	timeout  time.Duration
+	region   string
+}
+
+// region 为空时使用默认地域
+func (o connOptions) getRegion(region string) string {
+	if region == "" {
+		return o.region
+	}
+	return region
+}
+
+// endpoint 为空时使用 defaultEndpoint
+func (o connOptions) getEndpoint(defaultEndpoint string) string {
+	if o.endpoint != "" {
+		return o.endpoint
+	}
+	return defaultEndpoint
+}
+
+func (o connOptions) getScheme(defaultScheme string) string {
+	if o.scheme != "" {
+		return o.scheme
+	}
+	return defaultScheme
+}
@@ -0,0 +1,146 @@
+package go_cover_storage
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDecodeConfig(t *testing.T) {
+	keys := map[string]interface{}{"accessKey": " ak ", "secretKey": "sk"}
+	with := func(extra map[string]interface{}) map[string]interface{} {
+		options := make(map[string]interface{})
+		for key, value := range keys {
+			options[key] = value
+		}
+		for key, value := range extra {
+			options[key] = value
+		}
+		return options
+	}
+	tests := []struct {
+		name       string
+		clientName string
+		options    map[string]interface{}
+		want       Config
+		wantErr    error
+	}{
+		{
+			name:       "aliyun",
+			clientName: "aliyun",
+			options:    with(map[string]interface{}{"endpoint": " oss.example.com ", "scheme": "https", "region": "cn-hangzhou", "timeout": "5s"}),
+			want:       AliyunConfig{CloudConfig{AccessKey: "ak", SecretKey: "sk", Endpoint: "oss.example.com", Scheme: "https", Region: "cn-hangzhou", Timeout: 5 * time.Second}},
+		},
+		{
+			name:       "qiniu download domain",
+			clientName: "qiniu",
+			options:    with(map[string]interface{}{"downloadDomain": "dl.example.com"}),
+			want:       QiniuConfig{CloudConfig{AccessKey: "ak", SecretKey: "sk"}, "dl.example.com"},
+		},
+		{
+			name:       "tencent",
+			clientName: "tencent",
+			options:    with(map[string]interface{}{"appId": "1250000000"}),
+			want:       TencentConfig{CloudConfig{AccessKey: "ak", SecretKey: "sk"}, "1250000000"},
+		},
+		{
+			name:       "tencent without appId",
+			clientName: "tencent",
+			options:    with(nil),
+			wantErr:    ErrEmptyAppId,
+		},
+		{
+			name:       "local",
+			clientName: "local",
+			options:    map[string]interface{}{"tempDir": "/tmp/a", "storageDir": "/tmp/b"},
+			want:       LocalConfig{TempDir: "/tmp/a", StorageDir: "/tmp/b"},
+		},
+		{
+			name:       "missing secretKey",
+			clientName: "baidu",
+			options:    map[string]interface{}{"accessKey": "ak"},
+			wantErr:    ErrEmptySecretKey,
+		},
+		{
+			name:       "unknown key",
+			clientName: "huawei",
+			options:    with(map[string]interface{}{"endpiont": "obs.example.com"}),
+			wantErr:    ErrUnknownOption,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := DecodeConfig(test.clientName, test.options)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("err = %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cfg, test.want) {
+				t.Errorf("cfg = %#v, want %#v", cfg, test.want)
+			}
+		})
+	}
+	if _, err := DecodeConfig("unknown", keys); err == nil {
+		t.Error("unknown client should fail")
+	}
+}
+
+func TestDecodeConfigTimeout(t *testing.T) {
+	tests := []struct {
+		value   interface{}
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: nil, want: 0},
+		{value: 3 * time.Second, want: 3 * time.Second},
+		{value: 10, want: 10 * time.Second},
+		{value: int64(20), want: 20 * time.Second},
+		{value: 1.5, want: 1500 * time.Millisecond},
+		{value: json.Number("30"), want: 30 * time.Second},
+		{value: json.Number("0.25"), want: 250 * time.Millisecond},
+		{value: " 2m ", want: 2 * time.Minute},
+		{value: "500ms", want: 500 * time.Millisecond},
+		{value: "10", wantErr: true},
+		{value: "soon", wantErr: true},
+		{value: true, wantErr: true},
+	}
+	for _, test := range tests {
+		cfg, err := DecodeConfig("aliyun", map[string]interface{}{"accessKey": "ak", "secretKey": "sk", "timeout": test.value})
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("timeout %#v should fail", test.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("timeout %#v: %v", test.value, err)
+			continue
+		}
+		if got := cfg.(AliyunConfig).Timeout; got != test.want {
+			t.Errorf("timeout %#v = %v, want %v", test.value, got, test.want)
+		}
+	}
+	_, err := NewClient(AliyunConfig{CloudConfig{AccessKey: "ak", SecretKey: "sk", Timeout: -time.Second}})
+	if !errors.Is(err, ErrInvalidTimeout) {
+		t.Errorf("negative timeout = %v", err)
+	}
+}
+
+// 以前的 CreateClient 忽略多余的 key，仍然保持兼容
+func TestCreateClientIgnoresUnknownOptions(t *testing.T) {
+	client, err := CreateClient("aliyun", map[string]interface{}{"accessKey": "ak", "secretKey": "sk", "bucket": "legacy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = client.Close()
+	if _, err = CreateClient("aliyun", map[string]interface{}{"accessKey": "ak", "secretKey": "sk", "timeout": "soon"}); err == nil {
+		t.Error("invalid timeout should still fail")
+	}
+}
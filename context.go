@@ -0,0 +1,49 @@
+package go_cover_storage
+
+import (
+	"context"
+	"io"
+)
+
+// 可取消的读取器，ctx 取消后下一次读取立即返回错误
+// 用于不支持 context 的 SDK 中断正在进行的分片上传，以及中断本地文件复制
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func newContextReader(ctx context.Context, reader io.Reader) io.Reader {
+	return &contextReader{ctx: ctx, reader: reader}
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
+
+// 可取消的 io.ReadCloser，用于包装 SDK 返回的响应体
+type contextReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func newContextReadCloser(ctx context.Context, readCloser io.ReadCloser) io.ReadCloser {
+	return &contextReadCloser{
+		Reader: newContextReader(ctx, readCloser),
+		Closer: readCloser,
+	}
+}
+
+// 关闭后调用 release
+type releaseCloser struct {
+	io.Closer
+	release func()
+}
+
+func (c *releaseCloser) Close() error {
+	err := c.Closer.Close()
+	c.release()
+	return err
+}
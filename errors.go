@@ -0,0 +1,397 @@
+package go_cover_storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/baidubce/bce-sdk-go/bce"
+	"github.com/north-team/huawei-obs-sdk-go/obs"
+	"github.com/qiniu/go-sdk/v7/client"
+	"github.com/tencentyun/cos-go-sdk-v5"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// 各云存储统一的错误类型，使用 errors.Is 判断
+// ErrObjectNotFound 与 ErrNoSuchKey 相同，保留给旧代码使用
+var (
+	ErrNoSuchBucket   = errors.New("no such bucket")
+	ErrNoSuchKey      = ErrObjectNotFound
+	ErrNoSuchUpload   = errors.New("no such upload")
+	ErrAccessDenied   = errors.New("access denied")
+	ErrInvalidPart    = errors.New("invalid part")
+	ErrEntityTooSmall = errors.New("entity too small")
+	// 请求过于频繁被限流，稍后重试
+	ErrThrottled = errors.New("request throttled")
+	// 网络错误或服务端临时错误，可以重试
+	ErrTransient = errors.New("transient error")
+)
+
+// 客户端方法返回的错误，Err 为云存储 SDK 或本地文件系统的原始错误，可以用 errors.As 取出
+type StorageError struct {
+	Provider  string
+	Operation string
+	Bucket    string
+	Key       string
+	RequestID string
+	// 云存储返回的错误码和 HTTP 状态码，没有时为空
+	Code       string
+	StatusCode int
+	// 统一的错误类型，无法归类时为 nil
+	Kind error
+	Err  error
+}
+
+func (e *StorageError) Error() string {
+	message := fmt.Sprintf("%s %s", e.Provider, e.Operation)
+	if e.Bucket != "" {
+		message += " bucket=" + e.Bucket
+	}
+	if e.Key != "" {
+		message += " key=" + e.Key
+	}
+	if e.RequestID != "" {
+		message += " requestId=" + e.RequestID
+	}
+	if e.Kind != nil && !errors.Is(e.Err, e.Kind) {
+		message += ": " + e.Kind.Error()
+	}
+	return message + ": " + e.Err.Error()
+}
+
+func (e *StorageError) Unwrap() error {
+	return e.Err
+}
+
+func (e *StorageError) Is(target error) bool {
+	return e.Kind != nil && e.Kind == target
+}
+
+// 能重试的错误
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrThrottled) || errors.Is(err, ErrTransient)
+}
+
+// 按错误码归类，各云存储大多沿用 S3 的错误码
+var errorCodeKinds = map[string]error{
+	"NoSuchBucket":             ErrNoSuchBucket,
+	"NoSuchKey":                ErrNoSuchKey,
+	"NoSuchUpload":             ErrNoSuchUpload,
+	"AccessDenied":             ErrAccessDenied,
+	"AccessForbidden":          ErrAccessDenied,
+	"InvalidAccessKeyId":       ErrAccessDenied,
+	"SignatureDoesNotMatch":    ErrAccessDenied,
+	"InvalidPart":              ErrInvalidPart,
+	"InvalidPartOrder":         ErrInvalidPart,
+	"EntityTooSmall":           ErrEntityTooSmall,
+	"SlowDown":                 ErrThrottled,
+	"Throttling":               ErrThrottled,
+	"TooManyRequests":          ErrThrottled,
+	"RequestRateLimitExceeded": ErrThrottled,
+	"InternalError":            ErrTransient,
+	"ServiceUnavailable":       ErrTransient,
+	"RequestTimeout":           ErrTransient,
+}
+
+// 七牛的错误码
+var kodoErrorCodeKinds = map[int]error{
+	401: ErrAccessDenied,
+	403: ErrAccessDenied,
+	573: ErrThrottled,
+	599: ErrTransient,
+	612: ErrNoSuchKey,
+	631: ErrNoSuchBucket,
+}
+
+// 分片上传相关的操作，找不到时归类为 ErrNoSuchUpload
+var multipartOperations = map[string]bool{
+	"MultipartUploadPart":      true,
+	"MultipartUploadComplete":  true,
+	"MultipartUploadAbort":     true,
+	"MultipartUploadListParts": true,
+}
+
+// 把 err 转换为 *StorageError，已经转换过的错误直接返回
+func newStorageError(provider, operation, bucketName, objectKey string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var storageErr *StorageError
+	if errors.As(err, &storageErr) {
+		return err
+	}
+	storageErr = &StorageError{
+		Provider:  provider,
+		Operation: operation,
+		Bucket:    bucketName,
+		Key:       objectKey,
+		Err:       err,
+	}
+	storageErr.fillServiceError()
+	storageErr.Kind = storageErr.classify()
+	return storageErr
+}
+
+// 从各云存储 SDK 的错误中读取错误码、状态码和请求 id
+func (e *StorageError) fillServiceError() {
+	var (
+		ossErr    oss.ServiceError
+		bceErr    *bce.BceServiceError
+		obsErr    obs.ObsError
+		cosErr    *cos.ErrorResponse
+		kodoErr   *client.ErrorInfo
+		kodoS3Err *kodoS3Error
+	)
+	switch {
+	case errors.As(e.Err, &ossErr):
+		e.Code, e.StatusCode, e.RequestID = ossErr.Code, ossErr.StatusCode, ossErr.RequestID
+	case errors.As(e.Err, &bceErr):
+		e.Code, e.StatusCode, e.RequestID = bceErr.Code, bceErr.StatusCode, bceErr.RequestId
+	case errors.As(e.Err, &obsErr):
+		e.Code, e.StatusCode, e.RequestID = obsErr.Code, obsErr.StatusCode, obsErr.RequestId
+	case errors.As(e.Err, &cosErr):
+		e.Code, e.RequestID = cosErr.Code, cosErr.RequestID
+		if cosErr.Response != nil {
+			e.StatusCode = cosErr.Response.StatusCode
+		}
+	case errors.As(e.Err, &kodoErr):
+		e.Code, e.StatusCode, e.RequestID = fmt.Sprint(kodoErr.Code), kodoErr.Code, kodoErr.Reqid
+	case errors.As(e.Err, &kodoS3Err):
+		e.Code, e.StatusCode, e.RequestID = kodoS3Err.Code, kodoS3Err.StatusCode, kodoS3Err.RequestId
+	}
+}
+
+func (e *StorageError) classify() error {
+	for _, kind := range []error{
+		ErrNoSuchBucket, ErrNoSuchKey, ErrNoSuchUpload, ErrAccessDenied,
+		ErrInvalidPart, ErrEntityTooSmall, ErrThrottled, ErrTransient,
+	} {
+		if errors.Is(e.Err, kind) {
+			return kind
+		}
+	}
+	// ctx 取消或超时不重试，交给调用方处理
+	if errors.Is(e.Err, context.Canceled) || errors.Is(e.Err, context.DeadlineExceeded) {
+		return nil
+	}
+	var kodoErr *client.ErrorInfo
+	if errors.As(e.Err, &kodoErr) {
+		if kind, ok := kodoErrorCodeKinds[kodoErr.Code]; ok {
+			if kind == ErrNoSuchKey && multipartOperations[e.Operation] {
+				return ErrNoSuchUpload
+			}
+			return kind
+		}
+	} else if kind, ok := errorCodeKinds[e.Code]; ok {
+		return kind
+	}
+	switch {
+	case e.StatusCode == http.StatusNotFound:
+		if multipartOperations[e.Operation] {
+			return ErrNoSuchUpload
+		}
+		if e.Key == "" {
+			return ErrNoSuchBucket
+		}
+		return ErrNoSuchKey
+	case e.StatusCode == http.StatusForbidden || e.StatusCode == http.StatusUnauthorized:
+		return ErrAccessDenied
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrThrottled
+	case e.StatusCode >= http.StatusInternalServerError:
+		return ErrTransient
+	case e.StatusCode == 0 && errors.Is(e.Err, os.ErrNotExist):
+		if multipartOperations[e.Operation] {
+			return ErrNoSuchUpload
+		}
+		return ErrNoSuchKey
+	case e.StatusCode == 0 && errors.Is(e.Err, os.ErrPermission):
+		return ErrAccessDenied
+	}
+	var netErr net.Error
+	if errors.As(e.Err, &netErr) || errors.Is(e.Err, io.ErrUnexpectedEOF) {
+		return ErrTransient
+	}
+	return nil
+}
+
+// 为客户端方法返回的错误补充云存储、操作、bucket 和对象 key，NewClient 创建的客户端都会使用
+type errorClient struct {
+	provider string
+	client   StoreClient
+}
+
+func newErrorClient(provider string, client StoreClient) StoreClient {
+	return &errorClient{provider: provider, client: client}
+}
+
+// 取出被包装的客户端
+func unwrapStoreClient(client StoreClient) StoreClient {
+	for {
+		switch c := client.(type) {
+		case *errorClient:
+			client = c.client
+		default:
+			return client
+		}
+	}
+}
+
+func (c *errorClient) Close() error {
+	return c.client.Close()
+}
+
+func (c *errorClient) wrap(operation, bucketName, objectKey string, err error) error {
+	return newStorageError(c.provider, operation, bucketName, objectKey, err)
+}
+
+func (c *errorClient) MultipartUploadInit(bucketName, region, objectKey string) (string, error) {
+	return c.MultipartUploadInitWithContext(context.Background(), bucketName, region, objectKey)
+}
+
+func (c *errorClient) MultipartUploadInitWithContext(ctx context.Context, bucketName, region, objectKey string) (string, error) {
+	uploadId, err := c.client.MultipartUploadInitWithContext(ctx, bucketName, region, objectKey)
+	return uploadId, c.wrap("MultipartUploadInit", bucketName, objectKey, err)
+}
+
+func (c *errorClient) MultipartUploadPart(bucketName, region, objectKey, uploadId string, partNumber uint, body []byte) (*UploadPartResult, error) {
+	return c.MultipartUploadPartWithContext(context.Background(), bucketName, region, objectKey, uploadId, partNumber, body)
+}
+
+func (c *errorClient) MultipartUploadPartWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string, partNumber uint, body []byte) (*UploadPartResult, error) {
+	result, err := c.client.MultipartUploadPartWithContext(ctx, bucketName, region, objectKey, uploadId, partNumber, body)
+	return result, c.wrap("MultipartUploadPart", bucketName, objectKey, err)
+}
+
+func (c *errorClient) MultipartUploadPartFromReader(bucketName, region, objectKey, uploadId string, partNumber uint, reader io.Reader, size int64) (*UploadPartResult, error) {
+	return c.MultipartUploadPartFromReaderWithContext(context.Background(), bucketName, region, objectKey, uploadId, partNumber, reader, size)
+}
+
+func (c *errorClient) MultipartUploadPartFromReaderWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string, partNumber uint, reader io.Reader, size int64) (*UploadPartResult, error) {
+	result, err := c.client.MultipartUploadPartFromReaderWithContext(ctx, bucketName, region, objectKey, uploadId, partNumber, reader, size)
+	return result, c.wrap("MultipartUploadPart", bucketName, objectKey, err)
+}
+
+func (c *errorClient) MultipartUploadComplete(bucketName, region, objectKey, uploadId string, parts map[uint]string) (*CompleteResult, error) {
+	return c.MultipartUploadCompleteWithContext(context.Background(), bucketName, region, objectKey, uploadId, parts)
+}
+
+func (c *errorClient) MultipartUploadCompleteWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string, parts map[uint]string) (*CompleteResult, error) {
+	result, err := c.client.MultipartUploadCompleteWithContext(ctx, bucketName, region, objectKey, uploadId, parts)
+	return result, c.wrap("MultipartUploadComplete", bucketName, objectKey, err)
+}
+
+func (c *errorClient) MultipartUploadAbort(bucketName, region, objectKey, uploadId string) error {
+	return c.MultipartUploadAbortWithContext(context.Background(), bucketName, region, objectKey, uploadId)
+}
+
+func (c *errorClient) MultipartUploadAbortWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string) error {
+	err := c.client.MultipartUploadAbortWithContext(ctx, bucketName, region, objectKey, uploadId)
+	return c.wrap("MultipartUploadAbort", bucketName, objectKey, err)
+}
+
+func (c *errorClient) MultipartUploadListParts(bucketName, region, objectKey, uploadId string) ([]Part, error) {
+	return c.MultipartUploadListPartsWithContext(context.Background(), bucketName, region, objectKey, uploadId)
+}
+
+func (c *errorClient) MultipartUploadListPartsWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string) ([]Part, error) {
+	parts, err := c.client.MultipartUploadListPartsWithContext(ctx, bucketName, region, objectKey, uploadId)
+	return parts, c.wrap("MultipartUploadListParts", bucketName, objectKey, err)
+}
+
+func (c *errorClient) ListMultipartUploads(bucketName, region, prefix, marker string, maxUploads int) (*MultipartUploadList, error) {
+	return c.ListMultipartUploadsWithContext(context.Background(), bucketName, region, prefix, marker, maxUploads)
+}
+
+func (c *errorClient) ListMultipartUploadsWithContext(ctx context.Context, bucketName, region, prefix, marker string, maxUploads int) (*MultipartUploadList, error) {
+	list, err := c.client.ListMultipartUploadsWithContext(ctx, bucketName, region, prefix, marker, maxUploads)
+	return list, c.wrap("ListMultipartUploads", bucketName, "", err)
+}
+
+func (c *errorClient) PutObject(bucketName, region, objectKey string, reader io.Reader, size int64, opts *PutObjectOptions) (*CompleteResult, error) {
+	return c.PutObjectWithContext(context.Background(), bucketName, region, objectKey, reader, size, opts)
+}
+
+func (c *errorClient) PutObjectWithContext(ctx context.Context, bucketName, region, objectKey string, reader io.Reader, size int64, opts *PutObjectOptions) (*CompleteResult, error) {
+	result, err := c.client.PutObjectWithContext(ctx, bucketName, region, objectKey, reader, size, opts)
+	return result, c.wrap("PutObject", bucketName, objectKey, err)
+}
+
+func (c *errorClient) GetObject(bucketName, region, objectKey string, opts *GetObjectOptions) (io.ReadCloser, error) {
+	return c.GetObjectWithContext(context.Background(), bucketName, region, objectKey, opts)
+}
+
+func (c *errorClient) GetObjectWithContext(ctx context.Context, bucketName, region, objectKey string, opts *GetObjectOptions) (io.ReadCloser, error) {
+	body, err := c.client.GetObjectWithContext(ctx, bucketName, region, objectKey, opts)
+	return body, c.wrap("GetObject", bucketName, objectKey, err)
+}
+
+func (c *errorClient) StatObject(bucketName, region, objectKey string) (*ObjectInfo, error) {
+	return c.StatObjectWithContext(context.Background(), bucketName, region, objectKey)
+}
+
+func (c *errorClient) StatObjectWithContext(ctx context.Context, bucketName, region, objectKey string) (*ObjectInfo, error) {
+	info, err := c.client.StatObjectWithContext(ctx, bucketName, region, objectKey)
+	return info, c.wrap("StatObject", bucketName, objectKey, err)
+}
+
+func (c *errorClient) ListObjects(bucketName, region, prefix, delimiter, continuationToken string, maxKeys int) (*ObjectList, error) {
+	return c.ListObjectsWithContext(context.Background(), bucketName, region, prefix, delimiter, continuationToken, maxKeys)
+}
+
+func (c *errorClient) ListObjectsWithContext(ctx context.Context, bucketName, region, prefix, delimiter, continuationToken string, maxKeys int) (*ObjectList, error) {
+	list, err := c.client.ListObjectsWithContext(ctx, bucketName, region, prefix, delimiter, continuationToken, maxKeys)
+	return list, c.wrap("ListObjects", bucketName, "", err)
+}
+
+func (c *errorClient) CopyObject(bucketName, region, objectKey, srcBucketName, srcObjectKey string) (*CompleteResult, error) {
+	return c.CopyObjectWithContext(context.Background(), bucketName, region, objectKey, srcBucketName, srcObjectKey)
+}
+
+func (c *errorClient) CopyObjectWithContext(ctx context.Context, bucketName, region, objectKey, srcBucketName, srcObjectKey string) (*CompleteResult, error) {
+	result, err := c.client.CopyObjectWithContext(ctx, bucketName, region, objectKey, srcBucketName, srcObjectKey)
+	return result, c.wrap("CopyObject", bucketName, objectKey, err)
+}
+
+func (c *errorClient) PresignURL(method, bucketName, region, objectKey string, expiry time.Duration) (string, error) {
+	signedURL, err := c.client.PresignURL(method, bucketName, region, objectKey, expiry)
+	return signedURL, c.wrap("PresignURL", bucketName, objectKey, err)
+}
+
+func (c *errorClient) PresignMultipartUploadPart(bucketName, region, objectKey, uploadId string, partNumber uint, expiry time.Duration) (*PresignedPartRequest, error) {
+	request, err := c.client.PresignMultipartUploadPart(bucketName, region, objectKey, uploadId, partNumber, expiry)
+	return request, c.wrap("PresignMultipartUploadPart", bucketName, objectKey, err)
+}
+
+func (c *errorClient) PresignPostPolicy(bucketName, region string, policy *PostPolicy) (*PostPolicyForm, error) {
+	form, err := c.client.PresignPostPolicy(bucketName, region, policy)
+	return form, c.wrap("PresignPostPolicy", bucketName, "", err)
+}
+
+func (c *errorClient) DeleteObject(bucketName, region, objectKey string) error {
+	return c.DeleteObjectWithContext(context.Background(), bucketName, region, objectKey)
+}
+
+func (c *errorClient) DeleteObjectWithContext(ctx context.Context, bucketName, region, objectKey string) error {
+	err := c.client.DeleteObjectWithContext(ctx, bucketName, region, objectKey)
+	return c.wrap("DeleteObject", bucketName, objectKey, err)
+}
+
+func (c *errorClient) DeleteObjects(bucketName, region string, objectKeys []string) ([]DeleteResult, error) {
+	return c.DeleteObjectsWithContext(context.Background(), bucketName, region, objectKeys)
+}
+
+func (c *errorClient) DeleteObjectsWithContext(ctx context.Context, bucketName, region string, objectKeys []string) ([]DeleteResult, error) {
+	results, err := c.client.DeleteObjectsWithContext(ctx, bucketName, region, objectKeys)
+	if err != nil {
+		return nil, c.wrap("DeleteObjects", bucketName, "", err)
+	}
+	for i := range results {
+		results[i].Err = c.wrap("DeleteObjects", bucketName, results[i].Key, results[i].Err)
+	}
+	return results, nil
+}
@@ -0,0 +1,261 @@
+package go_cover_storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/baidubce/bce-sdk-go/bce"
+	"github.com/north-team/huawei-obs-sdk-go/obs"
+	"github.com/qiniu/go-sdk/v7/client"
+	"github.com/tencentyun/cos-go-sdk-v5"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestStorageErrorClassify(t *testing.T) {
+	tests := []struct {
+		name       string
+		operation  string
+		key        string
+		err        error
+		kind       error
+		code       string
+		statusCode int
+		requestID  string
+	}{
+		{
+			name: "oss code", operation: "GetObject", key: "k",
+			err:  oss.ServiceError{Code: "NoSuchKey", StatusCode: 404, RequestID: "oss-1"},
+			kind: ErrNoSuchKey, code: "NoSuchKey", statusCode: 404, requestID: "oss-1",
+		},
+		{
+			name: "bce throttled", operation: "PutObject", key: "k",
+			err:  &bce.BceServiceError{Code: "SlowDown", StatusCode: 503, RequestId: "bce-1"},
+			kind: ErrThrottled, code: "SlowDown", statusCode: 503, requestID: "bce-1",
+		},
+		{
+			name: "obs 404 in multipart", operation: "MultipartUploadPart", key: "k",
+			err:  obs.ObsError{BaseModel: obs.BaseModel{StatusCode: 404, RequestId: "obs-1"}},
+			kind: ErrNoSuchUpload, statusCode: 404, requestID: "obs-1",
+		},
+		{
+			name: "cos access denied", operation: "StatObject", key: "k",
+			err:  &cos.ErrorResponse{Code: "AccessDenied", RequestID: "cos-1", Response: &http.Response{StatusCode: 403}},
+			kind: ErrAccessDenied, code: "AccessDenied", statusCode: 403, requestID: "cos-1",
+		},
+		{
+			name: "kodo no such key", operation: "GetObject", key: "k",
+			err:  &client.ErrorInfo{Code: 612, Reqid: "kodo-1"},
+			kind: ErrNoSuchKey, code: "612", statusCode: 612, requestID: "kodo-1",
+		},
+		{
+			name: "kodo no such key in multipart", operation: "MultipartUploadComplete", key: "k",
+			err:  &client.ErrorInfo{Code: 612},
+			kind: ErrNoSuchUpload, code: "612", statusCode: 612,
+		},
+		{
+			name: "kodo throttled", operation: "PutObject", key: "k",
+			err:  &client.ErrorInfo{Code: 573},
+			kind: ErrThrottled, code: "573", statusCode: 573,
+		},
+		{
+			name: "kodo s3 invalid part", operation: "MultipartUploadComplete", key: "k",
+			err:  &kodoS3Error{StatusCode: 400, Code: "InvalidPart", RequestId: "s3-1"},
+			kind: ErrInvalidPart, code: "InvalidPart", statusCode: 400, requestID: "s3-1",
+		},
+		{
+			name: "404 without key", operation: "ListObjects",
+			err:  &bce.BceServiceError{StatusCode: 404},
+			kind: ErrNoSuchBucket, statusCode: 404,
+		},
+		{
+			name: "429", operation: "PutObject", key: "k",
+			err:  oss.ServiceError{StatusCode: 429},
+			kind: ErrThrottled, statusCode: 429,
+		},
+		{
+			name: "5xx", operation: "PutObject", key: "k",
+			err:  oss.ServiceError{StatusCode: 502},
+			kind: ErrTransient, statusCode: 502,
+		},
+		{
+			name: "unknown 400", operation: "PutObject", key: "k",
+			err:  oss.ServiceError{Code: "InvalidArgument", StatusCode: 400},
+			code: "InvalidArgument", statusCode: 400,
+		},
+		{
+			name: "local not exist", operation: "GetObject", key: "k",
+			err:  &os.PathError{Op: "open", Path: "/x", Err: os.ErrNotExist},
+			kind: ErrNoSuchKey,
+		},
+		{
+			name: "local not exist in multipart", operation: "MultipartUploadListParts", key: "k",
+			err:  &os.PathError{Op: "open", Path: "/x", Err: os.ErrNotExist},
+			kind: ErrNoSuchUpload,
+		},
+		{
+			name: "local permission", operation: "PutObject", key: "k",
+			err:  &os.PathError{Op: "open", Path: "/x", Err: os.ErrPermission},
+			kind: ErrAccessDenied,
+		},
+		{
+			name: "sentinel", operation: "MultipartUploadComplete", key: "k",
+			err:  fmt.Errorf("%w: part 2", ErrInvalidPart),
+			kind: ErrInvalidPart,
+		},
+		{
+			name: "network", operation: "PutObject", key: "k",
+			err:  &net.OpError{Op: "dial", Err: errors.New("connection refused")},
+			kind: ErrTransient,
+		},
+		{
+			name: "unexpected eof", operation: "GetObject", key: "k",
+			err:  io.ErrUnexpectedEOF,
+			kind: ErrTransient,
+		},
+		{
+			name: "canceled", operation: "PutObject", key: "k",
+			err: fmt.Errorf("upload: %w", context.Canceled),
+		},
+		{
+			name: "unknown", operation: "PutObject", key: "k",
+			err: errors.New("boom"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := newStorageError("provider", test.operation, "bucket", test.key, test.err)
+			var storageErr *StorageError
+			if !errors.As(err, &storageErr) {
+				t.Fatalf("%T is not a *StorageError", err)
+			}
+			if storageErr.Kind != test.kind {
+				t.Errorf("kind = %v, want %v", storageErr.Kind, test.kind)
+			}
+			if test.kind != nil && !errors.Is(err, test.kind) {
+				t.Errorf("errors.Is(err, %v) = false", test.kind)
+			}
+			if storageErr.Code != test.code || storageErr.StatusCode != test.statusCode || storageErr.RequestID != test.requestID {
+				t.Errorf("code, status, request id = %q, %d, %q", storageErr.Code, storageErr.StatusCode, storageErr.RequestID)
+			}
+			// obs.ObsError 不能用 == 比较
+			if fmt.Sprintf("%#v", storageErr.Err) != fmt.Sprintf("%#v", test.err) {
+				t.Error("original error is not wrapped")
+			}
+			if IsRetryable(err) != (test.kind == ErrThrottled || test.kind == ErrTransient) {
+				t.Errorf("IsRetryable = %v", IsRetryable(err))
+			}
+		})
+	}
+}
+
+func TestStorageErrorMessage(t *testing.T) {
+	err := newStorageError("aliyun", "GetObject", "bucket", "key", oss.ServiceError{Code: "NoSuchKey", StatusCode: 404, RequestID: "req-1", Message: "missing"})
+	message := err.Error()
+	for _, part := range []string{"aliyun GetObject", "bucket=bucket", "key=key", "requestId=req-1", ErrNoSuchKey.Error(), "NoSuchKey"} {
+		if !strings.Contains(message, part) {
+			t.Errorf("message %q does not contain %q", message, part)
+		}
+	}
+	// 原始错误已经是归类的错误时不重复
+	err = newStorageError("local", "MultipartUploadComplete", "bucket", "key", ErrNoSuchUpload)
+	if strings.Count(err.Error(), ErrNoSuchUpload.Error()) != 1 {
+		t.Errorf("message = %q", err.Error())
+	}
+	// 已经转换过的错误直接返回
+	if again := newStorageError("other", "PutObject", "", "", err); again != err {
+		t.Error("StorageError should not be wrapped twice")
+	}
+	if newStorageError("local", "PutObject", "", "", nil) != nil {
+		t.Error("nil error should stay nil")
+	}
+}
+
+// NewClient 创建的客户端返回的错误都是 *StorageError
+func TestErrorClientWrapsErrors(t *testing.T) {
+	client, cleanup := newTestLocalClient(t)
+	defer cleanup()
+	if _, ok := client.(*errorClient); !ok {
+		t.Fatalf("NewClient returned %T", client)
+	}
+
+	_, err := client.StatObject("bucket", "", "missing")
+	var storageErr *StorageError
+	if !errors.As(err, &storageErr) {
+		t.Fatalf("err = %v", err)
+	}
+	if storageErr.Provider != "local" || storageErr.Operation != "StatObject" || storageErr.Bucket != "bucket" || storageErr.Key != "missing" {
+		t.Errorf("storage error = %+v", storageErr)
+	}
+	if !errors.Is(err, ErrNoSuchKey) || !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("err = %v, want ErrNoSuchKey", err)
+	}
+	var pathErr *os.PathError
+	if !errors.As(err, &pathErr) {
+		t.Error("original *os.PathError is not reachable with errors.As")
+	}
+
+	if _, err = client.MultipartUploadListParts("bucket", "", "key", "wrong-upload"); !errors.Is(err, ErrNoSuchUpload) {
+		t.Errorf("wrong upload id = %v", err)
+	}
+	results, err := client.DeleteObjects("bucket", "", []string{"missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if result.Err != nil && !errors.As(result.Err, &storageErr) {
+			t.Errorf("delete result error %T is not wrapped", result.Err)
+		}
+	}
+}
+
+// ETag 不匹配或分片没有上传时返回 ErrInvalidPart，不能合并出缺少数据的对象
+func TestLocalCompleteRejectsInvalidParts(t *testing.T) {
+	client, cleanup := newTestLocalClient(t)
+	defer cleanup()
+	uploadId, err := client.MultipartUploadInit("bucket", "", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := make(map[uint]string)
+	for partNumber := uint(1); partNumber <= 3; partNumber++ {
+		result, err := client.MultipartUploadPart("bucket", "", "key", uploadId, partNumber, []byte(fmt.Sprint(partNumber)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[partNumber] = result.ETag
+	}
+	tests := map[string]map[uint]string{
+		"wrong etag":   {1: parts[1], 2: "wrong", 3: parts[3]},
+		"missing part": {1: parts[1], 2: parts[2], 3: parts[3], 4: unwrapStoreClient(client).(*local).partName(uploadId, 4)},
+	}
+	for name, completeParts := range tests {
+		_, err := client.MultipartUploadComplete("bucket", "", "key", uploadId, completeParts)
+		var storageErr *StorageError
+		if !errors.Is(err, ErrInvalidPart) || !errors.As(err, &storageErr) {
+			t.Errorf("%s: err = %v, want ErrInvalidPart", name, err)
+		}
+		if _, err = client.StatObject("bucket", "", "key"); !errors.Is(err, ErrNoSuchKey) {
+			t.Errorf("%s: object created by failed complete: %v", name, err)
+		}
+	}
+	// 失败后分片仍然保留，可以用正确的 ETag 完成
+	if _, err = client.MultipartUploadComplete("bucket", "", "key", uploadId, parts); err != nil {
+		t.Fatal(err)
+	}
+	body, err := client.GetObject("bucket", "", "key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	var buf bytes.Buffer
+	if _, err = buf.ReadFrom(body); err != nil || buf.String() != "123" {
+		t.Errorf("object = %q, %v", buf.String(), err)
+	}
+}
@@ -2,38 +2,175 @@ package go_cover_storage
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"github.com/north-team/huawei-obs-sdk-go/obs"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
 	"sort"
+	"strconv"
+	"sync"
+	"time"
 )
 
 // 华为云存储 obs
 type huawei struct {
 	accessKey, secretKey string
+	connOptions
+	cache *clientCache
 }
 
-func (h *huawei) getObsNewClient(region string) (*obs.ObsClient, error) {
-	endpoint := "https://obs." + region + ".myhuaweicloud.com"
-	return obs.New(h.accessKey, h.secretKey, endpoint)
+func init() {
+	Huawei = &huawei{}
+	mustRegisterProvider("huawei", Huawei.Init)
 }
 
-func (h *huawei) Init(options map[string]interface{}) (StoreClient, error) {
-	accessKey, secretKey, err := getAccessKeySecretKey(options)
+func (h *huawei) getObsEndpoint(region string) string {
+	return h.getEndpoint("obs." + h.getRegion(region) + ".myhuaweicloud.com")
+}
+
+// obs 的 ctx 只能在创建客户端时设置，并且没有按请求设置 ctx 的选项
+// 所以每个地域缓存一组 obs.ObsClient，客户端的 ctx 为可以切换的 obsRequestContext
+// 每次调用从中取出一个客户端独占使用，把 ctx 切换为本次调用的 ctx，调用 release 后放回，并发调用时才会创建新的客户端
+// Timeout 大于 0 时在 ctx 上设置超时，release 前有效，GetObject 在关闭响应体时 release，超时包括读取响应
+func (h *huawei) getObsClient(ctx context.Context, region string) (*obs.ObsClient, func(), error) {
+	endpoint := h.getScheme("https") + "://" + h.getObsEndpoint(region)
+	value, err := h.cache.get(cacheKey("obs", endpoint), func() (interface{}, error) {
+		return &obsClientPool{create: func() (*pooledObsClient, error) {
+			requestContext := &obsRequestContext{ctx: context.Background()}
+			obsClient, err := obs.New(h.accessKey, h.secretKey, endpoint, obs.WithRequestContext(requestContext), obs.WithHttpTransport(h.getObsTransport()))
+			if err != nil {
+				return nil, err
+			}
+			return &pooledObsClient{ObsClient: obsClient, ctx: requestContext}, nil
+		}}, nil
+	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	h.accessKey = accessKey
-	h.secretKey = secretKey
-	return &huawei{
-		accessKey: accessKey,
-		secretKey: secretKey,
-	}, nil
+	pool := value.(*obsClientPool)
+	client, err := pool.get()
+	if err != nil {
+		return nil, nil, err
+	}
+	cancel := context.CancelFunc(func() {})
+	if h.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+	}
+	client.ctx.set(ctx)
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			client.ctx.set(context.Background())
+			cancel()
+			pool.put(client)
+		})
+	}
+	return client.ObsClient, release, nil
+}
+
+// 同一个地域的空闲客户端
+type obsClientPool struct {
+	mu     sync.Mutex
+	free   []*pooledObsClient
+	create func() (*pooledObsClient, error)
+}
+
+type pooledObsClient struct {
+	*obs.ObsClient
+	ctx *obsRequestContext
+}
+
+func (p *obsClientPool) get() (*pooledObsClient, error) {
+	p.mu.Lock()
+	if n := len(p.free); n > 0 {
+		client := p.free[n-1]
+		p.free = p.free[:n-1]
+		p.mu.Unlock()
+		return client, nil
+	}
+	p.mu.Unlock()
+	return p.create()
+}
+
+func (p *obsClientPool) put(client *pooledObsClient) {
+	p.mu.Lock()
+	p.free = append(p.free, client)
+	p.mu.Unlock()
+}
+
+// 转发到当前 ctx 的 context.Context，客户端放回池中时切换为 context.Background()
+type obsRequestContext struct {
+	mu  sync.RWMutex
+	ctx context.Context
+}
+
+func (c *obsRequestContext) set(ctx context.Context) {
+	c.mu.Lock()
+	c.ctx = ctx
+	c.mu.Unlock()
+}
+
+func (c *obsRequestContext) current() context.Context {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ctx
+}
+
+func (c *obsRequestContext) Deadline() (time.Time, bool) {
+	return c.current().Deadline()
+}
+
+func (c *obsRequestContext) Done() <-chan struct{} {
+	return c.current().Done()
+}
+
+func (c *obsRequestContext) Err() error {
+	return c.current().Err()
+}
+
+func (c *obsRequestContext) Value(key interface{}) interface{} {
+	return c.current().Value(key)
+}
+
+// 传入 transport 后 obs 的超时配置不再生效，超时由 getObsClient 通过 ctx 设置
+func (h *huawei) getObsTransport() *http.Transport {
+	value, _ := h.cache.get("obsTransport", func() (interface{}, error) {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		// 与 obs 默认的连接池一致，响应体按原样返回
+		transport.MaxIdleConnsPerHost = obs.DEFAULT_MAX_CONN_PER_HOST
+		transport.DisableCompression = true
+		return transport, nil
+	})
+	return value.(*http.Transport)
+}
+
+func (h *huawei) Close() error {
+	h.cache.close()
+	return nil
+}
+
+func (h *huawei) Init(options map[string]interface{}) (StoreClient, error) {
+	return initClient("huawei", options)
 }
 
 func (h *huawei) MultipartUploadInit(bucketName, region, objectKey string) (string, error) {
-	obsClient, err := h.getObsNewClient(region)
+	return h.MultipartUploadInitWithContext(context.Background(), bucketName, region, objectKey)
+}
+
+func (h *huawei) MultipartUploadInitWithContext(ctx context.Context, bucketName, region, objectKey string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	obsClient, release, err := h.getObsClient(ctx, region)
 	if err != nil {
 		return "", err
 	}
+	defer release()
 	input := &obs.InitiateMultipartUploadInput{
 		ObjectOperationInput: obs.ObjectOperationInput{
 			Bucket: bucketName,
@@ -45,38 +182,69 @@ func (h *huawei) MultipartUploadInit(bucketName, region, objectKey string) (stri
 	if err != nil {
 		return "", err
 	}
-	obsClient.Close()
 	return output.UploadId, nil
 }
 
-func (h *huawei) MultipartUploadPart(bucketName, region, objectKey, uploadId string, partNumber uint, body []byte) (H, error) {
-	obsClient, err := h.getObsNewClient(region)
+func (h *huawei) MultipartUploadPart(bucketName, region, objectKey, uploadId string, partNumber uint, body []byte) (*UploadPartResult, error) {
+	return h.MultipartUploadPartWithContext(context.Background(), bucketName, region, objectKey, uploadId, partNumber, body)
+}
+
+func (h *huawei) MultipartUploadPartWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string, partNumber uint, body []byte) (*UploadPartResult, error) {
+	return h.MultipartUploadPartFromReaderWithContext(ctx, bucketName, region, objectKey, uploadId, partNumber, bytes.NewReader(body), int64(len(body)))
+}
+
+func (h *huawei) MultipartUploadPartFromReader(bucketName, region, objectKey, uploadId string, partNumber uint, reader io.Reader, size int64) (*UploadPartResult, error) {
+	return h.MultipartUploadPartFromReaderWithContext(context.Background(), bucketName, region, objectKey, uploadId, partNumber, reader, size)
+}
+
+func (h *huawei) MultipartUploadPartFromReaderWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string, partNumber uint, reader io.Reader, size int64) (*UploadPartResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	obsClient, release, err := h.getObsClient(ctx, region)
 	if err != nil {
 		return nil, err
 	}
+	defer release()
+	progress := startPartProgress(ctx, "huawei", bucketName, objectKey, uploadId, partNumber, size)
+	checksumReader := newChecksumReader(io.LimitReader(reader, size))
 	input := &obs.UploadPartInput{
 		Bucket:     bucketName,
 		Key:        objectKey,
 		PartNumber: int(partNumber),
 		UploadId:   uploadId,
-		Body:       bytes.NewReader(body),
+		Body:       newContextReader(ctx, progress.reader(checksumReader)),
+		PartSize:   size,
 	}
 	output, err := obsClient.UploadPart(input)
 	if err != nil {
+		progress.finish(nil, err)
 		return nil, err
 	}
 
-	return H{
-		"PartNumber": output.PartNumber,
-		"ETag":       output.ETag,
-	}, nil
+	result := &UploadPartResult{
+		PartNumber: partNumber,
+		ETag:       output.ETag,
+		Size:       size,
+		Checksum:   checksumReader.Checksum(),
+	}
+	progress.finish(result, nil)
+	return result, nil
 }
 
-func (h *huawei) MultipartUploadComplete(bucketName, region, objectKey, uploadId string, parts map[uint]string) (H, error) {
-	obsClient, err := h.getObsNewClient(region)
+func (h *huawei) MultipartUploadComplete(bucketName, region, objectKey, uploadId string, parts map[uint]string) (*CompleteResult, error) {
+	return h.MultipartUploadCompleteWithContext(context.Background(), bucketName, region, objectKey, uploadId, parts)
+}
+
+func (h *huawei) MultipartUploadCompleteWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string, parts map[uint]string) (*CompleteResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	obsClient, release, err := h.getObsClient(ctx, region)
 	if err != nil {
 		return nil, err
 	}
+	defer release()
 	inputParts := make([]obs.Part, 0)
 	for partNumber, eTag := range parts {
 		inputParts = append(inputParts, obs.Part{
@@ -99,10 +267,466 @@ func (h *huawei) MultipartUploadComplete(bucketName, region, objectKey, uploadId
 		return nil, err
 	}
 
-	return H{
-		"Location": result.Location,
-		"Bucket":   result.Bucket,
-		"ETag":     result.ETag,
-		"Key":      result.Key,
+	return &CompleteResult{
+		Bucket:    result.Bucket,
+		Key:       result.Key,
+		ETag:      result.ETag,
+		Location:  result.Location,
+		VersionID: result.VersionId,
+	}, nil
+}
+
+func (h *huawei) MultipartUploadAbort(bucketName, region, objectKey, uploadId string) error {
+	return h.MultipartUploadAbortWithContext(context.Background(), bucketName, region, objectKey, uploadId)
+}
+
+func (h *huawei) MultipartUploadAbortWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	obsClient, release, err := h.getObsClient(ctx, region)
+	if err != nil {
+		return err
+	}
+	defer release()
+	input := &obs.AbortMultipartUploadInput{
+		Bucket:   bucketName,
+		Key:      objectKey,
+		UploadId: uploadId,
+	}
+	_, err = obsClient.AbortMultipartUpload(input)
+	return err
+}
+
+func (h *huawei) MultipartUploadListParts(bucketName, region, objectKey, uploadId string) ([]Part, error) {
+	return h.MultipartUploadListPartsWithContext(context.Background(), bucketName, region, objectKey, uploadId)
+}
+
+func (h *huawei) MultipartUploadListPartsWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string) ([]Part, error) {
+	obsClient, release, err := h.getObsClient(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	parts := make([]Part, 0)
+	input := &obs.ListPartsInput{
+		Bucket:   bucketName,
+		Key:      objectKey,
+		UploadId: uploadId,
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		output, err := obsClient.ListParts(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, part := range output.Parts {
+			parts = append(parts, Part{
+				PartNumber:   part.PartNumber,
+				ETag:         part.ETag,
+				Size:         part.Size,
+				LastModified: part.LastModified,
+			})
+		}
+		if !output.IsTruncated {
+			return parts, nil
+		}
+		input.PartNumberMarker = output.NextPartNumberMarker
+	}
+}
+
+func (h *huawei) ListMultipartUploads(bucketName, region, prefix, marker string, maxUploads int) (*MultipartUploadList, error) {
+	return h.ListMultipartUploadsWithContext(context.Background(), bucketName, region, prefix, marker, maxUploads)
+}
+
+func (h *huawei) ListMultipartUploadsWithContext(ctx context.Context, bucketName, region, prefix, marker string, maxUploads int) (*MultipartUploadList, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	keyMarker, uploadIdMarker, err := decodeUploadMarker(marker)
+	if err != nil {
+		return nil, err
+	}
+	if maxUploads <= 0 {
+		maxUploads = defaultMaxUploads
+	}
+	obsClient, release, err := h.getObsClient(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	input := &obs.ListMultipartUploadsInput{
+		Bucket:         bucketName,
+		Prefix:         prefix,
+		MaxUploads:     maxUploads,
+		KeyMarker:      keyMarker,
+		UploadIdMarker: uploadIdMarker,
+	}
+	output, err := obsClient.ListMultipartUploads(input)
+	if err != nil {
+		return nil, err
+	}
+	list := &MultipartUploadList{Uploads: make([]MultipartUpload, 0, len(output.Uploads))}
+	for _, upload := range output.Uploads {
+		list.Uploads = append(list.Uploads, MultipartUpload{
+			Key:       upload.Key,
+			UploadId:  upload.UploadId,
+			Initiated: upload.Initiated,
+		})
+	}
+	if output.IsTruncated {
+		list.NextMarker = encodeUploadMarker(output.NextKeyMarker, output.NextUploadIdMarker)
+	}
+	return list, nil
+}
+
+func (h *huawei) PutObject(bucketName, region, objectKey string, reader io.Reader, size int64, opts *PutObjectOptions) (*CompleteResult, error) {
+	return h.PutObjectWithContext(context.Background(), bucketName, region, objectKey, reader, size, opts)
+}
+
+func (h *huawei) PutObjectWithContext(ctx context.Context, bucketName, region, objectKey string, reader io.Reader, size int64, opts *PutObjectOptions) (*CompleteResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	obsClient, release, err := h.getObsClient(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	input := &obs.PutObjectInput{}
+	input.Bucket = bucketName
+	input.Key = objectKey
+	input.ContentLength = size
+	if opts != nil {
+		input.ContentType = opts.ContentType
+		input.Metadata = opts.Metadata
+	}
+	input.Body = newContextReader(ctx, io.LimitReader(reader, size))
+	output, err := obsClient.PutObject(input)
+	if err != nil {
+		return nil, err
+	}
+	return &CompleteResult{
+		Bucket:    bucketName,
+		Key:       objectKey,
+		ETag:      output.ETag,
+		VersionID: output.VersionId,
+	}, nil
+}
+
+func (h *huawei) GetObject(bucketName, region, objectKey string, opts *GetObjectOptions) (io.ReadCloser, error) {
+	return h.GetObjectWithContext(context.Background(), bucketName, region, objectKey, opts)
+}
+
+func (h *huawei) GetObjectWithContext(ctx context.Context, bucketName, region, objectKey string, opts *GetObjectOptions) (io.ReadCloser, error) {
+	obsClient, release, err := h.getObsClient(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	input := &obs.GetObjectInput{}
+	input.Bucket = bucketName
+	input.Key = objectKey
+	byteRange := opts.byteRange()
+	if byteRange != nil {
+		input.RangeStart = byteRange.Start
+		input.RangeEnd = byteRange.End
+		// obs 不支持读到末尾的写法，结束位置超过对象大小时服务端会按对象大小截断
+		if byteRange.End < 0 {
+			input.RangeEnd = math.MaxInt64
+		}
+		// obs 只在结束位置大于开始位置时发送 Range，只读一个字节时多请求一个字节，返回时截断
+		if byteRange.End == byteRange.Start {
+			input.RangeEnd = byteRange.Start + 1
+		}
+	}
+	output, err := obsClient.GetObject(input)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	// 读取响应体时仍然使用本次调用的 ctx，关闭后才放回客户端
+	body := &contextReadCloser{Reader: output.Body, Closer: &releaseCloser{Closer: output.Body, release: release}}
+	if byteRange != nil && byteRange.End == byteRange.Start {
+		body.Reader = io.LimitReader(output.Body, 1)
+	}
+	return body, nil
+}
+
+func (h *huawei) StatObject(bucketName, region, objectKey string) (*ObjectInfo, error) {
+	return h.StatObjectWithContext(context.Background(), bucketName, region, objectKey)
+}
+
+func (h *huawei) StatObjectWithContext(ctx context.Context, bucketName, region, objectKey string) (*ObjectInfo, error) {
+	obsClient, release, err := h.getObsClient(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	input := &obs.GetObjectMetadataInput{
+		Bucket: bucketName,
+		Key:    objectKey,
+	}
+	output, err := obsClient.GetObjectMetadata(input)
+	if err != nil {
+		var obsErr obs.ObsError
+		if errors.As(err, &obsErr) && obsErr.StatusCode == http.StatusNotFound {
+			return nil, wrapNotFound(err)
+		}
+		return nil, err
+	}
+	return &ObjectInfo{
+		Key:          objectKey,
+		Size:         output.ContentLength,
+		ETag:         output.ETag,
+		ContentType:  output.ContentType,
+		LastModified: output.LastModified,
+		Metadata:     normalizeMetadata(output.Metadata),
+	}, nil
+}
+
+func (h *huawei) DeleteObject(bucketName, region, objectKey string) error {
+	return h.DeleteObjectWithContext(context.Background(), bucketName, region, objectKey)
+}
+
+func (h *huawei) DeleteObjectWithContext(ctx context.Context, bucketName, region, objectKey string) error {
+	obsClient, release, err := h.getObsClient(ctx, region)
+	if err != nil {
+		return err
+	}
+	defer release()
+	input := &obs.DeleteObjectInput{
+		Bucket: bucketName,
+		Key:    objectKey,
+	}
+	_, err = obsClient.DeleteObject(input)
+	return err
+}
+
+func (h *huawei) DeleteObjects(bucketName, region string, objectKeys []string) ([]DeleteResult, error) {
+	return h.DeleteObjectsWithContext(context.Background(), bucketName, region, objectKeys)
+}
+
+func (h *huawei) DeleteObjectsWithContext(ctx context.Context, bucketName, region string, objectKeys []string) ([]DeleteResult, error) {
+	obsClient, release, err := h.getObsClient(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	failed := make(map[string]error)
+	for _, keys := range chunkKeys(objectKeys, maxDeleteObjects) {
+		input := &obs.DeleteObjectsInput{
+			Bucket:  bucketName,
+			Quiet:   true,
+			Objects: make([]obs.ObjectToDelete, 0, len(keys)),
+		}
+		for _, key := range keys {
+			input.Objects = append(input.Objects, obs.ObjectToDelete{Key: key})
+		}
+		output, err := obsClient.DeleteObjects(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, deleteErr := range output.Errors {
+			failed[deleteErr.Key] = fmt.Errorf("%s: %s", deleteErr.Code, deleteErr.Message)
+		}
+	}
+	return deleteResults(objectKeys, failed), nil
+}
+
+func (h *huawei) ListObjects(bucketName, region, prefix, delimiter, continuationToken string, maxKeys int) (*ObjectList, error) {
+	return h.ListObjectsWithContext(context.Background(), bucketName, region, prefix, delimiter, continuationToken, maxKeys)
+}
+
+// obs 使用 marker 分页，continuationToken 即为 marker
+func (h *huawei) ListObjectsWithContext(ctx context.Context, bucketName, region, prefix, delimiter, continuationToken string, maxKeys int) (*ObjectList, error) {
+	obsClient, release, err := h.getObsClient(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if maxKeys <= 0 {
+		maxKeys = defaultMaxKeys
+	}
+	input := &obs.ListObjectsInput{
+		ListObjsInput: obs.ListObjsInput{
+			Prefix:    prefix,
+			MaxKeys:   maxKeys,
+			Delimiter: delimiter,
+		},
+		Bucket: bucketName,
+		Marker: continuationToken,
+	}
+	output, err := obsClient.ListObjects(input)
+	if err != nil {
+		return nil, err
+	}
+	list := &ObjectList{
+		Objects:        make([]ObjectInfo, 0, len(output.Contents)),
+		CommonPrefixes: output.CommonPrefixes,
+	}
+	for _, object := range output.Contents {
+		list.Objects = append(list.Objects, ObjectInfo{
+			Key:          object.Key,
+			Size:         object.Size,
+			ETag:         object.ETag,
+			LastModified: object.LastModified,
+		})
+	}
+	list.NextContinuationToken = nextListMarker(output.IsTruncated, output.NextMarker, list)
+	return list, nil
+}
+
+func (h *huawei) CopyObject(bucketName, region, objectKey, srcBucketName, srcObjectKey string) (*CompleteResult, error) {
+	return h.CopyObjectWithContext(context.Background(), bucketName, region, objectKey, srcBucketName, srcObjectKey)
+}
+
+func (h *huawei) CopyObjectWithContext(ctx context.Context, bucketName, region, objectKey, srcBucketName, srcObjectKey string) (*CompleteResult, error) {
+	srcInfo, err := h.StatObjectWithContext(ctx, srcBucketName, region, srcObjectKey)
+	if err != nil {
+		return nil, err
+	}
+	obsClient, release, err := h.getObsClient(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if srcInfo.Size > maxCopyObjectSize {
+		return multipartCopy(ctx, h, bucketName, region, objectKey, srcInfo.Size, func(uploadId string, partNumber int, start, end int64) (string, error) {
+			// obs 只在结束位置大于开始位置时发送复制区间，只有一个字节的分片会复制整个对象，改为读取后上传
+			if start == end {
+				return h.copyOneBytePart(ctx, bucketName, region, objectKey, uploadId, partNumber, srcBucketName, srcObjectKey, start)
+			}
+			input := &obs.CopyPartInput{
+				Bucket:               bucketName,
+				Key:                  objectKey,
+				UploadId:             uploadId,
+				PartNumber:           partNumber,
+				CopySourceBucket:     srcBucketName,
+				CopySourceKey:        srcObjectKey,
+				CopySourceRangeStart: start,
+				CopySourceRangeEnd:   end,
+			}
+			output, err := obsClient.CopyPart(input)
+			if err != nil {
+				return "", err
+			}
+			return output.ETag, nil
+		})
+	}
+	input := &obs.CopyObjectInput{}
+	input.Bucket = bucketName
+	input.Key = objectKey
+	input.CopySourceBucket = srcBucketName
+	input.CopySourceKey = srcObjectKey
+	output, err := obsClient.CopyObject(input)
+	if err != nil {
+		return nil, err
+	}
+	return &CompleteResult{
+		Bucket:    bucketName,
+		Key:       objectKey,
+		ETag:      output.ETag,
+		VersionID: output.VersionId,
+	}, nil
+}
+
+// 读取源对象 offset 处的一个字节，作为分片上传
+func (h *huawei) copyOneBytePart(ctx context.Context, bucketName, region, objectKey, uploadId string, partNumber int, srcBucketName, srcObjectKey string, offset int64) (string, error) {
+	body, err := h.GetObjectWithContext(ctx, srcBucketName, region, srcObjectKey, &GetObjectOptions{Range: &ByteRange{Start: offset, End: offset}})
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	if len(data) != 1 {
+		return "", io.ErrUnexpectedEOF
+	}
+	result, err := h.MultipartUploadPartWithContext(ctx, bucketName, region, objectKey, uploadId, uint(partNumber), data)
+	if err != nil {
+		return "", err
+	}
+	return result.ETag, nil
+}
+
+func (h *huawei) PresignURL(method, bucketName, region, objectKey string, expiry time.Duration) (string, error) {
+	method, err := checkPresign(method, expiry)
+	if err != nil {
+		return "", err
+	}
+	obsClient, release, err := h.getObsClient(context.Background(), region)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	input := &obs.CreateSignedUrlInput{
+		Method:  obs.HttpMethodType(method),
+		Bucket:  bucketName,
+		Key:     objectKey,
+		Expires: int(expiry / time.Second),
+	}
+	output, err := obsClient.CreateSignedUrl(input)
+	if err != nil {
+		return "", err
+	}
+	return output.SignedUrl, nil
+}
+
+// 分片的 ETag 在响应头 ETag 中，浏览器读取需要在 bucket 的 CORS 规则中暴露 ETag
+func (h *huawei) PresignMultipartUploadPart(bucketName, region, objectKey, uploadId string, partNumber uint, expiry time.Duration) (*PresignedPartRequest, error) {
+	if _, err := checkPresign(http.MethodPut, expiry); err != nil {
+		return nil, err
+	}
+	obsClient, release, err := h.getObsClient(context.Background(), region)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	expiration := time.Now().Add(expiry)
+	input := &obs.CreateSignedUrlInput{
+		Method:  obs.HttpMethodPut,
+		Bucket:  bucketName,
+		Key:     objectKey,
+		Expires: int(expiry / time.Second),
+		QueryParams: map[string]string{
+			"partNumber": strconv.Itoa(int(partNumber)),
+			"uploadId":   uploadId,
+		},
+	}
+	output, err := obsClient.CreateSignedUrl(input)
+	if err != nil {
+		return nil, err
+	}
+	return &PresignedPartRequest{
+		PartNumber: partNumber,
+		Method:     http.MethodPut,
+		URL:        output.SignedUrl,
+		Header:     http.Header{},
+		Expiration: expiration,
+	}, nil
+}
+
+func (h *huawei) PresignPostPolicy(bucketName, region string, policy *PostPolicy) (*PostPolicyForm, error) {
+	if err := checkPostPolicy(policy); err != nil {
+		return nil, err
+	}
+	expiration := time.Now().Add(policy.Expiry)
+	document, err := marshalPostPolicy(expiration, policy.conditions(bucketName))
+	if err != nil {
+		return nil, err
+	}
+	encodedPolicy := base64.StdEncoding.EncodeToString(document)
+	fields := policy.formFields()
+	fields["AccessKeyId"] = h.accessKey
+	fields["policy"] = encodedPolicy
+	fields["signature"] = base64.StdEncoding.EncodeToString(hmacSHA1([]byte(h.secretKey), encodedPolicy))
+	return &PostPolicyForm{
+		URL:        h.getScheme("https") + "://" + bucketName + "." + h.getObsEndpoint(region),
+		Fields:     fields,
+		Expiration: expiration,
 	}, nil
 }
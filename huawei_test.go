@@ -0,0 +1,179 @@
+package go_cover_storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 按偏移量生成内容的大对象，不占用内存
+type generatedObject struct {
+	size, offset int64
+}
+
+func generatedByte(offset int64) byte {
+	return byte(offset % 251)
+}
+
+func (o *generatedObject) Read(p []byte) (int, error) {
+	if o.offset >= o.size {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > o.size-o.offset {
+		p = p[:o.size-o.offset]
+	}
+	for i := range p {
+		p[i] = generatedByte(o.offset + int64(i))
+	}
+	o.offset += int64(len(p))
+	return len(p), nil
+}
+
+func (o *generatedObject) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		o.offset = offset
+	case io.SeekCurrent:
+		o.offset += offset
+	case io.SeekEnd:
+		o.offset = o.size + offset
+	}
+	return o.offset, nil
+}
+
+// 大小为 k*copyPartSize+1 的对象，最后一个分片只有一个字节，不能使用不带区间的复制
+func TestHuaweiCopyObjectOneByteLastPart(t *testing.T) {
+	size := int64(11*copyPartSize + 1)
+	var mu sync.Mutex
+	copyRanges := make(map[string]string)
+	uploadedParts := make(map[string][]byte)
+	completed := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		query := r.URL.Query()
+		switch {
+		case r.Method == http.MethodHead && r.URL.Path == "/bucket/src":
+			w.Header().Set("Content-Length", fmt.Sprint(size))
+			w.Header().Set("ETag", `"src"`)
+		case r.Method == http.MethodGet && r.URL.Path == "/bucket/src":
+			http.ServeContent(w, r, "", time.Time{}, &generatedObject{size: size})
+		case r.Method == http.MethodPost && r.URL.Path == "/bucket/dst" && query["uploads"] != nil:
+			fmt.Fprint(w, `<InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>dst</Key><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`)
+		case r.Method == http.MethodPut && r.URL.Path == "/bucket/dst" && query.Get("uploadId") == "upload-1":
+			partNumber := query.Get("partNumber")
+			if r.Header.Get("x-amz-copy-source") != "" {
+				copyRanges[partNumber] = r.Header.Get("x-amz-copy-source-range")
+				fmt.Fprintf(w, `<CopyPartResult><LastModified>2020-01-01T00:00:00.000Z</LastModified><ETag>"copy-%s"</ETag></CopyPartResult>`, partNumber)
+				return
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			uploadedParts[partNumber] = body
+			w.Header().Set("ETag", `"upload-`+partNumber+`"`)
+		case r.Method == http.MethodPost && r.URL.Path == "/bucket/dst" && query.Get("uploadId") == "upload-1":
+			completed = true
+			fmt.Fprint(w, `<CompleteMultipartUploadResult><Bucket>bucket</Bucket><Key>dst</Key><ETag>"done"</ETag></CompleteMultipartUploadResult>`)
+		default:
+			w.WriteHeader(http.StatusNotImplemented)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient(HuaweiConfig{CloudConfig{AccessKey: testAccessKey, SecretKey: testSecretKey, Endpoint: strings.TrimPrefix(server.URL, "http://"), Scheme: "http", Region: "cn-north-4"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err = client.CopyObject("bucket", "", "dst", "bucket", "src"); err != nil {
+		t.Fatal(err)
+	}
+	if !completed {
+		t.Fatal("multipart copy was not completed")
+	}
+	if len(copyRanges) != 11 {
+		t.Errorf("copied %d parts, want 11", len(copyRanges))
+	}
+	for partNumber := 1; partNumber <= 11; partNumber++ {
+		start := int64(partNumber-1) * copyPartSize
+		want := fmt.Sprintf("bytes=%d-%d", start, start+copyPartSize-1)
+		if got := copyRanges[fmt.Sprint(partNumber)]; got != want {
+			t.Errorf("part %d copy range = %q, want %q", partNumber, got, want)
+		}
+	}
+	if last := uploadedParts["12"]; len(last) != 1 || last[0] != generatedByte(size-1) {
+		t.Errorf("last part = %v, want [%d]", last, generatedByte(size-1))
+	}
+}
+
+// 同一个地域的 obs.ObsClient 放回后重复使用，只在并发调用时创建新的客户端
+func TestHuaweiClientPool(t *testing.T) {
+	h := HuaweiConfig{CloudConfig{AccessKey: testAccessKey, SecretKey: testSecretKey, Region: "cn-north-4"}}.newClient().(*huawei)
+	defer h.Close()
+	first, release, err := h.getObsClient(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	release()
+	second, releaseSecond, _ := h.getObsClient(context.Background(), "")
+	if second != first {
+		t.Error("released client should be reused")
+	}
+	third, releaseThird, _ := h.getObsClient(context.Background(), "")
+	if third == second {
+		t.Error("client in use should not be shared")
+	}
+	releaseSecond()
+	releaseThird()
+	other, releaseOther, _ := h.getObsClient(context.Background(), "ap-southeast-1")
+	defer releaseOther()
+	if other == first || other == third {
+		t.Error("clients of different regions should not be shared")
+	}
+	value, _ := h.cache.get(cacheKey("obs", "https://"+h.getObsEndpoint("")), nil)
+	if pool := value.(*obsClientPool); len(pool.free) != 2 {
+		t.Errorf("free clients = %d, want 2", len(pool.free))
+	}
+}
+
+// 缓存的客户端每次调用使用各自的 ctx，取消的 ctx 不影响之后的调用
+func TestHuaweiRequestContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bucket/slow" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Minute):
+			}
+			return
+		}
+		w.Header().Set("ETag", `"etag"`)
+	}))
+	defer server.Close()
+	client, err := NewClient(HuaweiConfig{CloudConfig{AccessKey: testAccessKey, SecretKey: testSecretKey, Endpoint: strings.TrimPrefix(server.URL, "http://"), Scheme: "http", Region: "cn-north-4"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err = client.StatObjectWithContext(ctx, "bucket", "", "slow"); err == nil {
+		t.Error("canceled request should fail")
+	}
+	// obs 出错后会等待几秒重试，重试时 ctx 已经取消
+	if elapsed := time.Since(start); elapsed > 15*time.Second {
+		t.Errorf("ctx was not applied, request took %v", elapsed)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err = client.StatObjectWithContext(context.Background(), "bucket", "", "fast"); err != nil {
+			t.Fatalf("request after canceled ctx: %v", err)
+		}
+	}
+}
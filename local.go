@@ -1,15 +1,22 @@
 package go_cover_storage
 
 import (
+	"bytes"
+	"context"
 	"crypto/md5"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"mime"
 	"os"
 	"path"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // 本地存储 local
@@ -17,11 +24,29 @@ type local struct {
 	tempDir, storageDir string
 }
 
+func init() {
+	Local = &local{}
+	mustRegisterProvider("local", Local.Init)
+}
+
 type uploadPart struct {
 	PartNumber int
 	ETag       string
 }
 
+// 分片上传的元数据，初始化时写入 tempDir/<uploadId>/upload.json
+// uploadId 是摘要，无法反推对象，列举分片上传时依赖该文件
+type localUploadMeta struct {
+	Bucket    string    `json:"bucket"`
+	Key       string    `json:"key"`
+	Initiated time.Time `json:"initiated"`
+}
+
+const localUploadMetaName = "upload.json"
+
+// 分片编号的最大值，与各云存储的限制保持一致
+const maxPartNumber = 10000
+
 var (
 	ErrEmptyTempDir     = errors.New("tempDir canot be empty")
 	ErrEmptyStorageDir  = errors.New("storageDir cannot be empty")
@@ -45,80 +70,132 @@ func (l *local) generateUploadId(bucketName, objectKey string) string {
 	return strings.ToUpper(md5str2)
 }
 
-func (l *local) Init(options map[string]interface{}) (StoreClient, error) {
-	tempDir, err := checkCommonStringKey("tempDir", options, ErrEmptyTempDir, ErrStringTempDir)
+func readLocalUploadMeta(partDir string) (*localUploadMeta, error) {
+	data, err := ioutil.ReadFile(path.Join(partDir, localUploadMetaName))
 	if err != nil {
 		return nil, err
 	}
-	storageDir, err := checkCommonStringKey("storageDir", options, ErrEmptyStorageDir, ErrStringStorageDir)
-	if err != nil {
+	meta := &localUploadMeta{}
+	if err = json.Unmarshal(data, meta); err != nil {
 		return nil, err
 	}
-	return &local{
-		tempDir:    tempDir,
-		storageDir: storageDir,
-	}, nil
+	return meta, nil
+}
+
+// 对象在本地的存储路径 storageDir/bucket/key
+func (l *local) storageFile(bucketName, objectKey string) string {
+	return safetyPath(path.Join(l.storageDir, bucketName, objectKey))
+}
+
+func (l *local) partName(uploadId string, partNumber int) string {
+	partName := fmt.Sprintf("%x", md5.Sum([]byte(uploadId+strconv.Itoa(partNumber))))
+	return strings.ToUpper(partName)
+}
+
+func (l *local) Init(options map[string]interface{}) (StoreClient, error) {
+	return initClient("local", options)
 }
 
 func (l *local) MultipartUploadInit(bucketName, region, objectKey string) (string, error) {
-	l.tempDir = safetyPath(l.tempDir)
-	l.storageDir = safetyPath(l.storageDir)
-	return l.generateUploadId(bucketName, objectKey), nil
+	return l.MultipartUploadInitWithContext(context.Background(), bucketName, region, objectKey)
 }
 
-func (l *local) MultipartUploadPart(bucketName, region, objectKey, uploadId string, partNumber uint, body []byte) (H, error) {
-	l.tempDir = safetyPath(l.tempDir)
-	l.storageDir = safetyPath(l.storageDir)
+func (l *local) MultipartUploadInitWithContext(ctx context.Context, bucketName, region, objectKey string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	uploadId := l.generateUploadId(bucketName, objectKey)
+	partDir := safetyPath(path.Join(l.tempDir, uploadId))
+	if err := os.MkdirAll(partDir, os.ModePerm); err != nil {
+		return "", err
+	}
+	meta, err := json.Marshal(localUploadMeta{
+		Bucket:    bucketName,
+		Key:       objectKey,
+		Initiated: time.Now(),
+	})
+	if err != nil {
+		return "", err
+	}
+	if err = ioutil.WriteFile(path.Join(partDir, localUploadMetaName), meta, os.ModePerm); err != nil {
+		return "", err
+	}
+	return uploadId, nil
+}
+
+func (l *local) MultipartUploadPart(bucketName, region, objectKey, uploadId string, partNumber uint, body []byte) (*UploadPartResult, error) {
+	return l.MultipartUploadPartWithContext(context.Background(), bucketName, region, objectKey, uploadId, partNumber, body)
+}
+
+func (l *local) MultipartUploadPartWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string, partNumber uint, body []byte) (*UploadPartResult, error) {
+	return l.MultipartUploadPartFromReaderWithContext(ctx, bucketName, region, objectKey, uploadId, partNumber, bytes.NewReader(body), int64(len(body)))
+}
+
+func (l *local) MultipartUploadPartFromReader(bucketName, region, objectKey, uploadId string, partNumber uint, reader io.Reader, size int64) (*UploadPartResult, error) {
+	return l.MultipartUploadPartFromReaderWithContext(context.Background(), bucketName, region, objectKey, uploadId, partNumber, reader, size)
+}
+
+func (l *local) MultipartUploadPartFromReaderWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string, partNumber uint, reader io.Reader, size int64) (*UploadPartResult, error) {
 	localUploadId := l.generateUploadId(bucketName, objectKey)
 	if localUploadId != uploadId {
-		return nil, errors.New("uploadId not exists")
+		return nil, ErrNoSuchUpload
 	}
 	partDir := safetyPath(path.Join(l.tempDir, uploadId))
 	err := os.MkdirAll(partDir, os.ModePerm)
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return nil, err
 	}
-	partName := fmt.Sprintf("%x", md5.Sum([]byte(uploadId+strconv.Itoa(int(partNumber)))))
-	partName = strings.ToUpper(partName)
+	partName := l.partName(uploadId, int(partNumber))
 	partPath := path.Join(partDir, partName+".part")
-	file, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY, os.ModePerm)
+	// 重传同一分片时需要截断旧文件
+	file, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
 	defer file.Close()
 	if err != nil {
 		return nil, err
 	}
-	if _, err = file.Write(body); err != nil {
+	progress := startPartProgress(ctx, "local", bucketName, objectKey, uploadId, partNumber, size)
+	checksumReader := newChecksumReader(io.LimitReader(reader, size))
+	written, err := io.Copy(file, newContextReader(ctx, progress.reader(checksumReader)))
+	if err == nil && written < size {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		progress.finish(nil, err)
 		return nil, err
 	}
 
-	return H{
-		"PartNumber": int(partNumber),
-		"ETag":       partName,
-	}, nil
+	result := &UploadPartResult{
+		PartNumber: partNumber,
+		ETag:       partName,
+		Size:       written,
+		Checksum:   checksumReader.Checksum(),
+	}
+	progress.finish(result, nil)
+	return result, nil
+}
+
+func (l *local) MultipartUploadComplete(bucketName, region, objectKey, uploadId string, parts map[uint]string) (*CompleteResult, error) {
+	return l.MultipartUploadCompleteWithContext(context.Background(), bucketName, region, objectKey, uploadId, parts)
 }
 
-func (l *local) MultipartUploadComplete(bucketName, region, objectKey, uploadId string, parts map[uint]string) (H, error) {
-	l.tempDir = safetyPath(l.tempDir)
-	l.storageDir = safetyPath(l.storageDir)
+func (l *local) MultipartUploadCompleteWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string, parts map[uint]string) (*CompleteResult, error) {
 	localUploadId := l.generateUploadId(bucketName, objectKey)
 	if localUploadId != uploadId {
-		return nil, errors.New("uploadId not exists")
+		return nil, ErrNoSuchUpload
 	}
-	storageFile := path.Join(l.storageDir, bucketName, objectKey)
-	storageFile = safetyPath(storageFile)
+	storageFile := l.storageFile(bucketName, objectKey)
 	storagePath := path.Dir(storageFile)
 	err := os.MkdirAll(storagePath, os.ModePerm)
 	if err != nil && !errors.Is(err, os.ErrExist) {
 		return nil, err
 	}
 
-	targetFile, err := os.OpenFile(storageFile, os.O_CREATE|os.O_RDWR, os.ModePerm)
-	defer targetFile.Close()
-	if err != nil {
-		return nil, err
-	}
-
 	newParts := make([]uploadPart, 0)
 	for partNumber, eTag := range parts {
+		// ETag 与上传的分片不一致时不能跳过，否则合并出的对象缺少数据
+		if l.partName(uploadId, int(partNumber)) != eTag {
+			return nil, fmt.Errorf("%w: part %d etag %s does not match", ErrInvalidPart, partNumber, eTag)
+		}
 		newParts = append(newParts, uploadPart{
 			PartNumber: int(partNumber),
 			ETag:       eTag,
@@ -128,25 +205,493 @@ func (l *local) MultipartUploadComplete(bucketName, region, objectKey, uploadId
 		return newParts[i].PartNumber < newParts[j].PartNumber
 	})
 
+	// 与 PutObject 相同，先合并到同目录下的临时文件再重命名，失败时原有对象不变，也不会留下不完整的对象
+	// 重命名只替换目录项，目标是 CopyObject 创建的硬链接时不会修改源对象
+	tempFile, err := ioutil.TempFile(storagePath, ".complete-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tempFile.Name())
 	partDir := safetyPath(path.Join(l.tempDir, uploadId))
-	for _, part := range newParts {
-		partName := fmt.Sprintf("%x", md5.Sum([]byte(uploadId+strconv.Itoa(part.PartNumber))))
-		partName = strings.ToUpper(partName)
-		if partName != part.ETag {
+	err = l.mergeParts(ctx, tempFile, partDir, newParts)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// 分片文件保留，取消后可以重新合并
+		return nil, err
+	}
+	if err = os.Chmod(tempFile.Name(), 0644); err != nil {
+		return nil, err
+	}
+	if err = os.Rename(tempFile.Name(), storageFile); err != nil {
+		return nil, err
+	}
+	_ = os.RemoveAll(partDir)
+	return l.localCompleteResult(bucketName, objectKey)
+}
+
+// 按顺序把分片写入 target
+func (l *local) mergeParts(ctx context.Context, target io.Writer, partDir string, parts []uploadPart) error {
+	for _, part := range parts {
+		partFile, err := os.Open(path.Join(partDir, part.ETag+".part"))
+		if err != nil {
+			// 分片目录还在时是没有上传的分片，目录不存在时分片上传已经完成或取消
+			if _, statErr := os.Stat(partDir); errors.Is(err, os.ErrNotExist) && statErr == nil {
+				return fmt.Errorf("%w: part %d has not been uploaded", ErrInvalidPart, part.PartNumber)
+			}
+			return err
+		}
+		_, err = io.Copy(target, newContextReader(ctx, partFile))
+		_ = partFile.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *local) MultipartUploadAbort(bucketName, region, objectKey, uploadId string) error {
+	return l.MultipartUploadAbortWithContext(context.Background(), bucketName, region, objectKey, uploadId)
+}
+
+func (l *local) MultipartUploadAbortWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	localUploadId := l.generateUploadId(bucketName, objectKey)
+	if localUploadId != uploadId {
+		return ErrNoSuchUpload
+	}
+	partDir := safetyPath(path.Join(l.tempDir, uploadId))
+	return os.RemoveAll(partDir)
+}
+
+func (l *local) MultipartUploadListParts(bucketName, region, objectKey, uploadId string) ([]Part, error) {
+	return l.MultipartUploadListPartsWithContext(context.Background(), bucketName, region, objectKey, uploadId)
+}
+
+func (l *local) MultipartUploadListPartsWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string) ([]Part, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	localUploadId := l.generateUploadId(bucketName, objectKey)
+	if localUploadId != uploadId {
+		return nil, ErrNoSuchUpload
+	}
+	partDir := safetyPath(path.Join(l.tempDir, uploadId))
+	files, err := ioutil.ReadDir(partDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []Part{}, nil
+		}
+		return nil, err
+	}
+	// 分片文件名是 uploadId 和分片编号的摘要，无法反推编号，这里按编号逐个计算后对照
+	partFiles := make(map[string]os.FileInfo, len(files))
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), ".part") {
+			partFiles[strings.TrimSuffix(file.Name(), ".part")] = file
+		}
+	}
+	parts := make([]Part, 0, len(partFiles))
+	for partNumber := 1; partNumber <= maxPartNumber && len(parts) < len(partFiles); partNumber++ {
+		partName := l.partName(uploadId, partNumber)
+		file, ok := partFiles[partName]
+		if !ok {
+			continue
+		}
+		parts = append(parts, Part{
+			PartNumber:   partNumber,
+			ETag:         partName,
+			Size:         file.Size(),
+			LastModified: file.ModTime(),
+		})
+	}
+	return parts, nil
+}
+
+func (l *local) ListMultipartUploads(bucketName, region, prefix, marker string, maxUploads int) (*MultipartUploadList, error) {
+	return l.ListMultipartUploadsWithContext(context.Background(), bucketName, region, prefix, marker, maxUploads)
+}
+
+func (l *local) ListMultipartUploadsWithContext(ctx context.Context, bucketName, region, prefix, marker string, maxUploads int) (*MultipartUploadList, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	keyMarker, uploadIdMarker, err := decodeUploadMarker(marker)
+	if err != nil {
+		return nil, err
+	}
+	if maxUploads <= 0 {
+		maxUploads = defaultMaxUploads
+	}
+	dirs, err := ioutil.ReadDir(l.tempDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &MultipartUploadList{Uploads: []MultipartUpload{}}, nil
+		}
+		return nil, err
+	}
+	uploads := make([]MultipartUpload, 0)
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		// 没有元数据的目录无法确定所属对象，直接跳过
+		meta, err := readLocalUploadMeta(path.Join(l.tempDir, dir.Name()))
+		if err != nil {
 			continue
 		}
-		partPath := path.Join(partDir, partName+".part")
-		part, err := os.Open(partPath)
+		if meta.Bucket != bucketName || !strings.HasPrefix(meta.Key, prefix) {
+			continue
+		}
+		uploads = append(uploads, MultipartUpload{
+			Key:       meta.Key,
+			UploadId:  dir.Name(),
+			Initiated: meta.Initiated,
+		})
+	}
+	sort.Slice(uploads, func(i, j int) bool {
+		if uploads[i].Key != uploads[j].Key {
+			return uploads[i].Key < uploads[j].Key
+		}
+		return uploads[i].UploadId < uploads[j].UploadId
+	})
+
+	list := &MultipartUploadList{Uploads: make([]MultipartUpload, 0)}
+	for _, upload := range uploads {
+		if keyMarker != "" && (upload.Key < keyMarker || upload.Key == keyMarker && upload.UploadId <= uploadIdMarker) {
+			continue
+		}
+		if len(list.Uploads) == maxUploads {
+			last := list.Uploads[len(list.Uploads)-1]
+			list.NextMarker = encodeUploadMarker(last.Key, last.UploadId)
+			break
+		}
+		list.Uploads = append(list.Uploads, upload)
+	}
+	return list, nil
+}
+
+// 本地存储没有元数据，opts 会被忽略
+func (l *local) PutObject(bucketName, region, objectKey string, reader io.Reader, size int64, opts *PutObjectOptions) (*CompleteResult, error) {
+	return l.PutObjectWithContext(context.Background(), bucketName, region, objectKey, reader, size, opts)
+}
+
+func (l *local) PutObjectWithContext(ctx context.Context, bucketName, region, objectKey string, reader io.Reader, size int64, opts *PutObjectOptions) (*CompleteResult, error) {
+	storageFile := l.storageFile(bucketName, objectKey)
+	storagePath := path.Dir(storageFile)
+	if err := os.MkdirAll(storagePath, os.ModePerm); err != nil {
+		return nil, err
+	}
+	// 先写入同目录下的临时文件再重命名，上传中断时不会留下不完整的对象
+	tempFile, err := ioutil.TempFile(storagePath, ".put-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tempFile.Name())
+	written, err := io.Copy(tempFile, newContextReader(ctx, io.LimitReader(reader, size)))
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if written < size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	// TempFile 创建的文件只有当前用户可读
+	if err = os.Chmod(tempFile.Name(), 0644); err != nil {
+		return nil, err
+	}
+	if err = os.Rename(tempFile.Name(), storageFile); err != nil {
+		return nil, err
+	}
+	return l.localCompleteResult(bucketName, objectKey)
+}
+
+func (l *local) GetObject(bucketName, region, objectKey string, opts *GetObjectOptions) (io.ReadCloser, error) {
+	return l.GetObjectWithContext(context.Background(), bucketName, region, objectKey, opts)
+}
+
+func (l *local) GetObjectWithContext(ctx context.Context, bucketName, region, objectKey string, opts *GetObjectOptions) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(l.storageFile(bucketName, objectKey))
+	if err != nil {
+		return nil, err
+	}
+	byteRange := opts.byteRange()
+	if byteRange == nil {
+		return newContextReadCloser(ctx, file), nil
+	}
+	if _, err = file.Seek(byteRange.Start, io.SeekStart); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	var reader io.Reader = file
+	if byteRange.End >= 0 {
+		reader = io.LimitReader(file, byteRange.End-byteRange.Start+1)
+	}
+	return &contextReadCloser{
+		Reader: newContextReader(ctx, reader),
+		Closer: file,
+	}, nil
+}
+
+// 本地存储没有元数据，ContentType 根据扩展名推断，ETag 由修改时间和大小生成
+func (l *local) StatObject(bucketName, region, objectKey string) (*ObjectInfo, error) {
+	return l.StatObjectWithContext(context.Background(), bucketName, region, objectKey)
+}
+
+func (l *local) StatObjectWithContext(ctx context.Context, bucketName, region, objectKey string) (*ObjectInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(l.storageFile(bucketName, objectKey))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, wrapNotFound(err)
+		}
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, wrapNotFound(fmt.Errorf("%s is a directory", objectKey))
+	}
+	return &ObjectInfo{
+		Key:          objectKey,
+		Size:         info.Size(),
+		ETag:         localETag(info),
+		ContentType:  mime.TypeByExtension(path.Ext(objectKey)),
+		LastModified: info.ModTime(),
+		Metadata:     map[string]string{},
+	}, nil
+}
+
+func (l *local) DeleteObject(bucketName, region, objectKey string) error {
+	return l.DeleteObjectWithContext(context.Background(), bucketName, region, objectKey)
+}
+
+func (l *local) DeleteObjectWithContext(ctx context.Context, bucketName, region, objectKey string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	err := os.Remove(l.storageFile(bucketName, objectKey))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (l *local) DeleteObjects(bucketName, region string, objectKeys []string) ([]DeleteResult, error) {
+	return l.DeleteObjectsWithContext(context.Background(), bucketName, region, objectKeys)
+}
+
+func (l *local) DeleteObjectsWithContext(ctx context.Context, bucketName, region string, objectKeys []string) ([]DeleteResult, error) {
+	failed := make(map[string]error)
+	for _, objectKey := range objectKeys {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := l.DeleteObjectWithContext(ctx, bucketName, region, objectKey); err != nil {
+			failed[objectKey] = err
+		}
+	}
+	return deleteResults(objectKeys, failed), nil
+}
+
+func (l *local) ListObjects(bucketName, region, prefix, delimiter, continuationToken string, maxKeys int) (*ObjectList, error) {
+	return l.ListObjectsWithContext(context.Background(), bucketName, region, prefix, delimiter, continuationToken, maxKeys)
+}
+
+// 遍历 storageDir/<bucket> 下的文件，key 按字典序排列，continuationToken 为上一页最后一个对象或公共前缀
+func (l *local) ListObjectsWithContext(ctx context.Context, bucketName, region, prefix, delimiter, continuationToken string, maxKeys int) (*ObjectList, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if maxKeys <= 0 {
+		maxKeys = defaultMaxKeys
+	}
+	bucketDir := safetyPath(path.Join(l.storageDir, bucketName))
+	files := make(map[string]os.FileInfo)
+	err := filepath.Walk(bucketDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		// 跳过 PutObject、CopyObject 写入中的临时文件
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".put-") || strings.HasPrefix(info.Name(), ".copy-") {
+			return nil
+		}
+		relPath, err := filepath.Rel(bucketDir, filePath)
 		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(relPath)
+		if strings.HasPrefix(key, prefix) {
+			files[key] = info
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	keys := make([]string, 0, len(files))
+	for key := range files {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	list := &ObjectList{
+		Objects:        make([]ObjectInfo, 0),
+		CommonPrefixes: make([]string, 0),
+	}
+	count := 0
+	lastEntry := ""
+	for _, key := range keys {
+		if key <= continuationToken {
+			continue
+		}
+		entry := key
+		isPrefix := false
+		if delimiter != "" {
+			if index := strings.Index(key[len(prefix):], delimiter); index >= 0 {
+				entry = key[:len(prefix)+index+len(delimiter)]
+				isPrefix = true
+			}
+		}
+		// 同一公共前缀下的对象只返回一次，上一页已返回的公共前缀也要跳过
+		if isPrefix && (entry == lastEntry || entry <= continuationToken) {
+			continue
+		}
+		if count >= maxKeys {
+			list.NextContinuationToken = lastEntry
+			break
+		}
+		if isPrefix {
+			list.CommonPrefixes = append(list.CommonPrefixes, entry)
+		} else {
+			info := files[key]
+			list.Objects = append(list.Objects, ObjectInfo{
+				Key:          key,
+				Size:         info.Size(),
+				ETag:         localETag(info),
+				LastModified: info.ModTime(),
+			})
+		}
+		lastEntry = entry
+		count++
+	}
+	return list, nil
+}
+
+func (l *local) CopyObject(bucketName, region, objectKey, srcBucketName, srcObjectKey string) (*CompleteResult, error) {
+	return l.CopyObjectWithContext(context.Background(), bucketName, region, objectKey, srcBucketName, srcObjectKey)
+}
+
+// 优先使用硬链接，跨设备等无法链接时复制文件内容
+func (l *local) CopyObjectWithContext(ctx context.Context, bucketName, region, objectKey, srcBucketName, srcObjectKey string) (*CompleteResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	srcFile := l.storageFile(srcBucketName, srcObjectKey)
+	storageFile := l.storageFile(bucketName, objectKey)
+	info, err := os.Stat(srcFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, wrapNotFound(err)
+		}
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, wrapNotFound(fmt.Errorf("%s is a directory", srcObjectKey))
+	}
+	if srcFile == storageFile {
+		return l.localCompleteResult(bucketName, objectKey)
+	}
+	storagePath := path.Dir(storageFile)
+	if err = os.MkdirAll(storagePath, os.ModePerm); err != nil {
+		return nil, err
+	}
+	// 先链接或复制到同目录下的临时文件再重命名，目标已存在时不会修改与其共享数据的其他硬链接
+	tempFile, err := ioutil.TempFile(storagePath, ".copy-*")
+	if err != nil {
+		return nil, err
+	}
+	tempName := tempFile.Name()
+	defer os.Remove(tempName)
+	if err = tempFile.Close(); err != nil {
+		return nil, err
+	}
+	if err = os.Remove(tempName); err != nil {
+		return nil, err
+	}
+	if err = os.Link(srcFile, tempName); err != nil {
+		if err = copyLocalFile(ctx, srcFile, tempName); err != nil {
 			return nil, err
 		}
-		_, _ = io.Copy(targetFile, part)
-		_ = part.Close()
-		_ = os.Remove(partPath)
 	}
-	_ = os.Remove(partDir)
+	if err = os.Rename(tempName, storageFile); err != nil {
+		return nil, err
+	}
+	return l.localCompleteResult(bucketName, objectKey)
+}
 
-	return H{
-		"path": storageFile,
+// 写入完成后对象的结果，Location 为文件路径
+func (l *local) localCompleteResult(bucketName, objectKey string) (*CompleteResult, error) {
+	storageFile := l.storageFile(bucketName, objectKey)
+	info, err := os.Stat(storageFile)
+	if err != nil {
+		return nil, err
+	}
+	return &CompleteResult{
+		Bucket:   bucketName,
+		Key:      objectKey,
+		ETag:     localETag(info),
+		Location: storageFile,
 	}, nil
 }
+
+// 本地存储没有 ETag，由修改时间和大小生成
+func localETag(info os.FileInfo) string {
+	return fmt.Sprintf("%x-%x", info.ModTime().UnixNano(), info.Size())
+}
+
+func copyLocalFile(ctx context.Context, srcFile, destFile string) error {
+	src, err := os.Open(srcFile)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dest, err := os.OpenFile(destFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dest, newContextReader(ctx, src))
+	if closeErr := dest.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// 本地存储没有签名机制，不支持预签名
+func (l *local) PresignURL(method, bucketName, region, objectKey string, expiry time.Duration) (string, error) {
+	return "", fmt.Errorf("%w: local storage", ErrUnsupportedPresignMethod)
+}
+
+func (l *local) PresignMultipartUploadPart(bucketName, region, objectKey, uploadId string, partNumber uint, expiry time.Duration) (*PresignedPartRequest, error) {
+	return nil, fmt.Errorf("%w: local storage", ErrUnsupportedPresignMethod)
+}
+
+func (l *local) PresignPostPolicy(bucketName, region string, policy *PostPolicy) (*PostPolicyForm, error) {
+	return nil, fmt.Errorf("%w: local storage", ErrUnsupportedPresignMethod)
+}
+
+// 本地存储没有需要释放的资源
+func (l *local) Close() error {
+	return nil
+}
@@ -0,0 +1,90 @@
+package go_cover_storage
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func uploadLocalParts(t *testing.T, client StoreClient, objectKey string, bodies ...string) (string, map[uint]string) {
+	t.Helper()
+	uploadId, err := client.MultipartUploadInit("bucket", "", objectKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := make(map[uint]string)
+	for i, body := range bodies {
+		result, err := client.MultipartUploadPart("bucket", "", objectKey, uploadId, uint(i+1), []byte(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[uint(i+1)] = result.ETag
+	}
+	return uploadId, parts
+}
+
+// 合并失败时原有对象不变，存储目录中不留下临时文件
+func TestLocalCompleteKeepsExistingObject(t *testing.T) {
+	client, cleanup := newTestLocalClient(t)
+	defer cleanup()
+	if _, err := client.PutObject("bucket", "", "dir/key", strings.NewReader("old"), 3, nil); err != nil {
+		t.Fatal(err)
+	}
+	uploadId, parts := uploadLocalParts(t, client, "dir/key", "new-1;", "new-2;")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.MultipartUploadCompleteWithContext(ctx, "bucket", "", "dir/key", uploadId, parts); err == nil {
+		t.Fatal("complete with canceled ctx should fail")
+	}
+	missing := map[uint]string{1: parts[1], 2: parts[2], 3: unwrapStoreClient(client).(*local).partName(uploadId, 3)}
+	if _, err := client.MultipartUploadComplete("bucket", "", "dir/key", uploadId, missing); err == nil {
+		t.Fatal("complete with a missing part should fail")
+	}
+	if got := string(readObject(t, client, "dir/key")); got != "old" {
+		t.Errorf("object after failed complete = %q, want old", got)
+	}
+	storageDir := filepath.Dir(unwrapStoreClient(client).(*local).storageFile("bucket", "dir/key"))
+	files, err := ioutil.ReadDir(storageDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		names := make([]string, 0, len(files))
+		for _, file := range files {
+			names = append(names, file.Name())
+		}
+		t.Errorf("files in storage dir = %v", names)
+	}
+
+	if _, err = client.MultipartUploadComplete("bucket", "", "dir/key", uploadId, parts); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(readObject(t, client, "dir/key")); got != "new-1;new-2;" {
+		t.Errorf("object = %q", got)
+	}
+}
+
+// 目标是 CopyObject 创建的副本时，合并不能修改源对象
+func TestLocalCompleteOverCopiedObject(t *testing.T) {
+	client, cleanup := newTestLocalClient(t)
+	defer cleanup()
+	if _, err := client.PutObject("bucket", "", "src", strings.NewReader("source"), 6, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CopyObject("bucket", "", "dst", "bucket", "src"); err != nil {
+		t.Fatal(err)
+	}
+	uploadId, parts := uploadLocalParts(t, client, "dst", "merged")
+	if _, err := client.MultipartUploadComplete("bucket", "", "dst", uploadId, parts); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(readObject(t, client, "src")); got != "source" {
+		t.Errorf("source = %q", got)
+	}
+	if got := string(readObject(t, client, "dst")); got != "merged" {
+		t.Errorf("destination = %q", got)
+	}
+}
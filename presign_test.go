@@ -0,0 +1,199 @@
+package go_cover_storage
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testAccessKey = "AKIDEXAMPLE"
+	testSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	testObjectKey = "dir/a b.txt"
+)
+
+func hmacSHA256Hex(key, data string) string {
+	return hex.EncodeToString(hmacSHA256([]byte(key), data))
+}
+
+func sha1Hex(data string) string {
+	sum := sha1.Sum([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// 按各云存储文档中的签名算法重新计算预签名链接的签名
+func TestPresignURLSignature(t *testing.T) {
+	tests := []struct {
+		cfg    Config
+		host   string
+		verify func(t *testing.T, method string, u *url.URL)
+	}{
+		{
+			cfg:  AliyunConfig{CloudConfig{AccessKey: testAccessKey, SecretKey: testSecretKey, Region: "cn-hangzhou"}},
+			host: "bucket.oss-cn-hangzhou.aliyuncs.com",
+			verify: func(t *testing.T, method string, u *url.URL) {
+				query := u.Query()
+				checkQuery(t, query, "OSSAccessKeyId", testAccessKey)
+				// VERB\nContent-MD5\nContent-Type\nExpires\nCanonicalizedResource
+				stringToSign := method + "\n\n\n" + query.Get("Expires") + "\n/bucket/" + testObjectKey
+				checkQuery(t, query, "Signature", base64.StdEncoding.EncodeToString(hmacSHA1([]byte(testSecretKey), stringToSign)))
+			},
+		},
+		{
+			cfg:  BaiduConfig{CloudConfig{AccessKey: testAccessKey, SecretKey: testSecretKey, Region: "bj"}},
+			host: "bucket.bj.bcebos.com",
+			verify: func(t *testing.T, method string, u *url.URL) {
+				// bce-auth-v1/{accessKey}/{timestamp}/{expiration}/{signedHeaders}/{signature}
+				fields := strings.Split(u.Query().Get("authorization"), "/")
+				if len(fields) != 6 || fields[0] != "bce-auth-v1" || fields[1] != testAccessKey || fields[3] != "3600" || fields[4] != "host" {
+					t.Fatalf("authorization = %v", fields)
+				}
+				signingKey := hmacSHA256Hex(testSecretKey, strings.Join(fields[:4], "/"))
+				canonicalRequest := method + "\n/dir/a%20b.txt\n\nhost:" + u.Host
+				if signature := hmacSHA256Hex(signingKey, canonicalRequest); fields[5] != signature {
+					t.Errorf("signature = %s, want %s", fields[5], signature)
+				}
+			},
+		},
+		{
+			cfg:  HuaweiConfig{CloudConfig{AccessKey: testAccessKey, SecretKey: testSecretKey, Region: "cn-north-4"}},
+			host: "bucket.obs.cn-north-4.myhuaweicloud.com:443",
+			verify: func(t *testing.T, method string, u *url.URL) {
+				query := u.Query()
+				checkQuery(t, query, "AWSAccessKeyId", testAccessKey)
+				stringToSign := method + "\n\n\n" + query.Get("Expires") + "\n/bucket/dir/a%20b.txt"
+				checkQuery(t, query, "Signature", base64.StdEncoding.EncodeToString(hmacSHA1([]byte(testSecretKey), stringToSign)))
+			},
+		},
+		{
+			cfg:  TencentConfig{CloudConfig{AccessKey: testAccessKey, SecretKey: testSecretKey, Region: "ap-guangzhou"}, "1250000000"},
+			host: "bucket-1250000000.cos.ap-guangzhou.myqcloud.com",
+			verify: func(t *testing.T, method string, u *url.URL) {
+				query := u.Query()
+				checkQuery(t, query, "q-sign-algorithm", "sha1")
+				checkQuery(t, query, "q-ak", testAccessKey)
+				checkQuery(t, query, "q-header-list", "host")
+				signKey := hex.EncodeToString(hmacSHA1([]byte(testSecretKey), query.Get("q-key-time")))
+				httpString := strings.ToLower(method) + "\n/" + testObjectKey + "\n\nhost=" + u.Host + "\n"
+				stringToSign := "sha1\n" + query.Get("q-sign-time") + "\n" + sha1Hex(httpString) + "\n"
+				checkQuery(t, query, "q-signature", hex.EncodeToString(hmacSHA1([]byte(signKey), stringToSign)))
+			},
+		},
+		{
+			cfg:  QiniuConfig{CloudConfig{AccessKey: testAccessKey, SecretKey: testSecretKey}, "dl.example.com"},
+			host: "dl.example.com",
+			verify: func(t *testing.T, method string, u *url.URL) {
+				// token 为 accessKey:urlsafe_base64(hmac_sha1(secretKey, 不带 token 的链接))
+				unsigned := strings.SplitN(u.String(), "&token=", 2)[0]
+				token := testAccessKey + ":" + base64.URLEncoding.EncodeToString(hmacSHA1([]byte(testSecretKey), unsigned))
+				checkQuery(t, u.Query(), "token", token)
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.cfg.Provider(), func(t *testing.T) {
+			client, err := NewClient(test.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+			methods := []string{"GET", "PUT", "HEAD", "DELETE"}
+			if test.cfg.Provider() == "qiniu" {
+				methods = methods[:1]
+			}
+			for _, method := range methods {
+				presignedURL, err := client.PresignURL(strings.ToLower(method), "bucket", "", testObjectKey, time.Hour)
+				if err != nil {
+					t.Fatal(err)
+				}
+				u, err := url.Parse(presignedURL)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if u.Host != test.host {
+					t.Errorf("%s host = %s, want %s", method, u.Host, test.host)
+				}
+				test.verify(t, method, u)
+			}
+		})
+	}
+}
+
+func TestQiniuPresignURLScheme(t *testing.T) {
+	client, err := NewClient(QiniuConfig{CloudConfig{AccessKey: testAccessKey, SecretKey: testSecretKey, Scheme: "https"}, "dl.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	presignedURL, err := client.PresignURL("GET", "bucket", "", testObjectKey, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(presignedURL, "https://dl.example.com/dir/a%20b.txt?e=") {
+		t.Errorf("url = %s", presignedURL)
+	}
+	if _, err = NewClient(QiniuConfig{CloudConfig{AccessKey: testAccessKey, SecretKey: testSecretKey}, "http://dl.example.com"}); err == nil {
+		t.Error("download domain with scheme should be rejected")
+	}
+}
+
+// 表单地址默认使用 https，配置 Scheme 后使用配置的 scheme
+func TestPresignPostPolicyScheme(t *testing.T) {
+	tests := []struct {
+		cfg  func(scheme string) Config
+		host string
+	}{
+		{
+			cfg: func(scheme string) Config {
+				return AliyunConfig{CloudConfig{AccessKey: testAccessKey, SecretKey: testSecretKey, Region: "cn-hangzhou", Scheme: scheme}}
+			},
+			host: "bucket.oss-cn-hangzhou.aliyuncs.com",
+		},
+		{
+			cfg: func(scheme string) Config {
+				return BaiduConfig{CloudConfig{AccessKey: testAccessKey, SecretKey: testSecretKey, Region: "bj", Scheme: scheme}}
+			},
+			host: "bucket.bj.bcebos.com",
+		},
+		{
+			cfg: func(scheme string) Config {
+				return HuaweiConfig{CloudConfig{AccessKey: testAccessKey, SecretKey: testSecretKey, Region: "cn-north-4", Scheme: scheme}}
+			},
+			host: "bucket.obs.cn-north-4.myhuaweicloud.com",
+		},
+		{
+			cfg: func(scheme string) Config {
+				return TencentConfig{CloudConfig{AccessKey: testAccessKey, SecretKey: testSecretKey, Region: "ap-guangzhou", Scheme: scheme}, "1250000000"}
+			},
+			host: "bucket-1250000000.cos.ap-guangzhou.myqcloud.com",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.cfg("").Provider(), func(t *testing.T) {
+			for scheme, want := range map[string]string{"": "https", "https": "https", "http": "http"} {
+				client, err := NewClient(test.cfg(scheme))
+				if err != nil {
+					t.Fatal(err)
+				}
+				form, err := client.PresignPostPolicy("bucket", "", &PostPolicy{Expiry: time.Hour, Key: testObjectKey})
+				client.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if form.URL != want+"://"+test.host {
+					t.Errorf("scheme %q url = %s, want %s://%s", scheme, form.URL, want, test.host)
+				}
+			}
+		})
+	}
+}
+
+func checkQuery(t *testing.T, query url.Values, key, want string) {
+	t.Helper()
+	if got := query.Get(key); got != want {
+		t.Errorf("%s = %s, want %s", key, got, want)
+	}
+}
@@ -0,0 +1,480 @@
+package go_cover_storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 配置文件中的一个存储配置
+// 文件的顶层为 profiles，其下按名称配置，例如 YAML：
+//
+//	profiles:
+//	  prod:
+//	    provider: aliyun
+//	    bucket: assets
+//	    region: cn-hangzhou
+//	    options:
+//	      accessKey: ${OSS_ACCESS_KEY}
+//	      secretKey: ${OSS_SECRET_KEY}
+type Profile struct {
+	Name     string `json:"-"`
+	Provider string `json:"provider"`
+	Bucket   string `json:"bucket"`
+	Region   string `json:"region"`
+	// 传给 CreateClient 的 options
+	Options map[string]interface{} `json:"options"`
+}
+
+// 配置文件创建的客户端，使用时需要配置中的 Bucket 和 Region
+type ProfileClient struct {
+	Name   string
+	Bucket string
+	Region string
+	Client StoreClient
+}
+
+// 把配置文件内容解析为通用的 map，数字可以解析为 json.Number 以保留原文
+type ProfileDecoder func(data []byte) (map[string]interface{}, error)
+
+var (
+	ErrEmptyProfileProvider  = errors.New("profile provider cannot be empty")
+	ErrUnsupportedProfileExt = errors.New("unsupported profile file extension")
+	ErrProfileEnvNotSet      = errors.New("profile environment variable is not set")
+)
+
+var (
+	profileDecodersMu sync.RWMutex
+	// 内置的 YAML、TOML 解析只支持嵌套的键值和标量，需要完整语法时可以注册第三方库
+	profileDecoders = map[string]ProfileDecoder{
+		".json": decodeJSONProfile,
+		".yaml": decodeYAMLProfile,
+		".yml":  decodeYAMLProfile,
+		".toml": decodeTOMLProfile,
+	}
+)
+
+// 注册或替换配置文件扩展名对应的解析函数，ext 需要带点，例如 .yaml
+func RegisterProfileDecoder(ext string, decoder ProfileDecoder) {
+	profileDecodersMu.Lock()
+	defer profileDecodersMu.Unlock()
+	profileDecoders[strings.ToLower(ext)] = decoder
+}
+
+// 读取配置文件，根据扩展名选择解析方式，并展开字符串中的 ${ENV} 和 ${ENV:-默认值}
+func LoadProfiles(filename string) (map[string]*Profile, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	profileDecodersMu.RLock()
+	decoder, ok := profileDecoders[ext]
+	profileDecodersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedProfileExt, ext)
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	document, err := decoder(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", filename, err)
+	}
+	expanded, err := expandProfileEnv(document)
+	if err != nil {
+		return nil, err
+	}
+	// 通过 json 转换为结构体，各种格式的字段名保持一致，数字保留为 json.Number，不会变成 float64 丢失精度
+	encoded, err := json.Marshal(expanded)
+	if err != nil {
+		return nil, err
+	}
+	file := struct {
+		Profiles map[string]*profileFields `json:"profiles"`
+	}{}
+	jsonDecoder := json.NewDecoder(bytes.NewReader(encoded))
+	jsonDecoder.UseNumber()
+	if err = jsonDecoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", filename, err)
+	}
+	profiles := make(map[string]*Profile, len(file.Profiles))
+	for name, fields := range file.Profiles {
+		if fields == nil {
+			return nil, fmt.Errorf("profile %s: %w", name, ErrEmptyProfileProvider)
+		}
+		profile := &Profile{
+			Name:     name,
+			Provider: strings.TrimSpace(fields.Provider.String()),
+			Bucket:   fields.Bucket.String(),
+			Region:   fields.Region.String(),
+			Options:  fields.Options,
+		}
+		if profile.Provider == "" {
+			return nil, fmt.Errorf("profile %s: %w", name, ErrEmptyProfileProvider)
+		}
+		profiles[name] = profile
+	}
+	return profiles, nil
+}
+
+// 配置文件中的 Profile，bucket 等字段没有加引号的数字同样作为字符串
+type profileFields struct {
+	Provider profileString          `json:"provider"`
+	Bucket   profileString          `json:"bucket"`
+	Region   profileString          `json:"region"`
+	Options  map[string]interface{} `json:"options"`
+}
+
+type profileString string
+
+func (s *profileString) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return err
+	}
+	if value == nil {
+		return nil
+	}
+	stringValue, ok := optionString(value)
+	if !ok {
+		return fmt.Errorf("%s is not a string", data)
+	}
+	*s = profileString(stringValue)
+	return nil
+}
+
+func (s profileString) String() string {
+	return string(s)
+}
+
+// 读取配置文件并为每个配置创建客户端
+func LoadProfileClients(filename string) (map[string]*ProfileClient, error) {
+	profiles, err := LoadProfiles(filename)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	clients := make(map[string]*ProfileClient, len(profiles))
+	for _, name := range names {
+		profile := profiles[name]
+		client, err := profile.NewClient()
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %w", name, err)
+		}
+		clients[name] = &ProfileClient{Name: name, Bucket: profile.Bucket, Region: profile.Region, Client: client}
+	}
+	return clients, nil
+}
+
+// 通过 CreateClient 创建客户端，Region 不为空且 options 中没有 region 时作为默认地域
+func (p *Profile) NewClient() (StoreClient, error) {
+	options := make(map[string]interface{}, len(p.Options)+1)
+	for key, value := range p.Options {
+		options[key] = value
+	}
+	if _, ok := options["region"]; !ok && p.Region != "" {
+		options["region"] = p.Region
+	}
+	return CreateClient(p.Provider, options)
+}
+
+var profileEnvPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// 只展开 ${ENV} 形式，避免密钥中的 $ 被误处理
+func expandProfileEnv(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		var expandErr error
+		expanded := profileEnvPattern.ReplaceAllStringFunc(v, func(match string) string {
+			groups := profileEnvPattern.FindStringSubmatch(match)
+			if env, ok := os.LookupEnv(groups[1]); ok {
+				return env
+			}
+			if groups[2] != "" {
+				return groups[3]
+			}
+			if expandErr == nil {
+				expandErr = fmt.Errorf("%w: %s", ErrProfileEnvNotSet, groups[1])
+			}
+			return match
+		})
+		return expanded, expandErr
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			expanded, err := expandProfileEnv(item)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = expanded
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			expanded, err := expandProfileEnv(item)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, expanded)
+		}
+		return result, nil
+	}
+	return value, nil
+}
+
+func decodeJSONProfile(data []byte) (map[string]interface{}, error) {
+	document := make(map[string]interface{})
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+// 去掉不在引号中的 # 注释
+func stripProfileComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// 解析标量，带引号的为字符串，其他依次尝试布尔值、数字
+// 数字保留原文为 json.Number，例如 appId: 1250000000 可以作为字符串配置项使用；01、1_000 等不是 JSON 数字的按字符串处理
+func parseProfileScalar(value string, nullWords ...string) (interface{}, error) {
+	if value == "" {
+		return "", nil
+	}
+	switch value[0] {
+	case '"':
+		return strconv.Unquote(value)
+	case '\'':
+		if len(value) < 2 || value[len(value)-1] != '\'' {
+			return nil, fmt.Errorf("invalid quoted string %s", value)
+		}
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	case '[', '{':
+		return nil, fmt.Errorf("unsupported value %s", value)
+	}
+	for _, word := range nullWords {
+		if value == word {
+			return nil, nil
+		}
+	}
+	if value == "true" || value == "false" {
+		return value == "true", nil
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil && json.Valid([]byte(value)) {
+		return json.Number(value), nil
+	}
+	return value, nil
+}
+
+func unquoteProfileKey(key string) (string, error) {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return "", errors.New("empty key")
+	}
+	if key[0] == '"' || key[0] == '\'' {
+		value, err := parseProfileScalar(key)
+		if err != nil {
+			return "", err
+		}
+		return value.(string), nil
+	}
+	return key, nil
+}
+
+// 简化的 YAML 解析，支持用空格缩进的嵌套映射、标量和注释，不支持列表、多行字符串和锚点
+func decodeYAMLProfile(data []byte) (map[string]interface{}, error) {
+	type frame struct {
+		indent int
+		values map[string]interface{}
+	}
+	root := make(map[string]interface{})
+	stack := []frame{{indent: 0, values: root}}
+	// 值为空的 key 等待下一行更深的缩进确定是否为映射
+	var pendingValues map[string]interface{}
+	var pendingKey string
+	pendingIndent := -1
+	for lineNumber, rawLine := range strings.Split(string(data), "\n") {
+		line := strings.TrimRight(stripProfileComment(strings.TrimRight(rawLine, "\r")), " \t")
+		content := strings.TrimLeft(line, " ")
+		if content == "" || content == "---" {
+			continue
+		}
+		if strings.HasPrefix(content, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", lineNumber+1)
+		}
+		if strings.HasPrefix(content, "- ") || content == "-" {
+			return nil, fmt.Errorf("line %d: lists are not supported", lineNumber+1)
+		}
+		indent := len(line) - len(content)
+		if pendingIndent >= 0 {
+			if indent > pendingIndent {
+				child := make(map[string]interface{})
+				pendingValues[pendingKey] = child
+				stack = append(stack, frame{indent: indent, values: child})
+			}
+			pendingIndent = -1
+		}
+		for len(stack) > 1 && stack[len(stack)-1].indent > indent {
+			stack = stack[:len(stack)-1]
+		}
+		current := stack[len(stack)-1]
+		if current.indent != indent {
+			return nil, fmt.Errorf("line %d: invalid indentation", lineNumber+1)
+		}
+		separator := yamlKeySeparator(content)
+		if separator < 0 {
+			return nil, fmt.Errorf("line %d: expected key: value", lineNumber+1)
+		}
+		key, err := unquoteProfileKey(content[:separator])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber+1, err)
+		}
+		value := strings.TrimSpace(content[separator+1:])
+		if value == "" {
+			current.values[key] = nil
+			pendingValues, pendingKey, pendingIndent = current.values, key, indent
+			continue
+		}
+		if current.values[key], err = parseProfileScalar(value, "null", "~"); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber+1, err)
+		}
+	}
+	return root, nil
+}
+
+// key 与值之间的冒号位置，冒号后需要是空格或行尾
+func yamlKeySeparator(content string) int {
+	var quote byte
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ':' && (i == len(content)-1 || content[i+1] == ' '):
+			return i
+		}
+	}
+	return -1
+}
+
+// 简化的 TOML 解析，支持 [表]、点分隔的 key、标量和注释，不支持数组和内联表
+func decodeTOMLProfile(data []byte) (map[string]interface{}, error) {
+	root := make(map[string]interface{})
+	current := root
+	for lineNumber, rawLine := range strings.Split(string(data), "\n") {
+		line := strings.TrimSpace(stripProfileComment(strings.TrimRight(rawLine, "\r")))
+		if line == "" {
+			continue
+		}
+		var err error
+		if strings.HasPrefix(line, "[") {
+			if strings.HasPrefix(line, "[[") || !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: unsupported table header", lineNumber+1)
+			}
+			if current, err = tomlTable(root, line[1:len(line)-1]); err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNumber+1, err)
+			}
+			continue
+		}
+		separator := strings.Index(line, "=")
+		if separator < 0 {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNumber+1)
+		}
+		keys := splitTOMLKey(line[:separator])
+		table, err := tomlTable(current, strings.Join(keys[:len(keys)-1], "."))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber+1, err)
+		}
+		key, err := unquoteProfileKey(keys[len(keys)-1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber+1, err)
+		}
+		if table[key], err = parseProfileScalar(strings.TrimSpace(line[separator+1:])); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber+1, err)
+		}
+	}
+	return root, nil
+}
+
+// 按点分隔 key，引号中的点不分隔
+func splitTOMLKey(key string) []string {
+	parts := make([]string, 0)
+	var quote byte
+	start := 0
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '.':
+			parts = append(parts, key[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, key[start:])
+}
+
+// 返回 path 对应的表，不存在时创建
+func tomlTable(root map[string]interface{}, path string) (map[string]interface{}, error) {
+	table := root
+	if strings.TrimSpace(path) == "" {
+		return table, nil
+	}
+	for _, part := range splitTOMLKey(path) {
+		key, err := unquoteProfileKey(part)
+		if err != nil {
+			return nil, err
+		}
+		child, ok := table[key]
+		if !ok {
+			child = make(map[string]interface{})
+			table[key] = child
+		}
+		childTable, ok := child.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s is not a table", key)
+		}
+		table = childTable
+	}
+	return table, nil
+}
@@ -0,0 +1,328 @@
+package go_cover_storage
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type profileDecoderTest struct {
+	name    string
+	input   string
+	want    map[string]interface{}
+	wantErr bool
+}
+
+func runProfileDecoderTests(t *testing.T, decoder ProfileDecoder, tests []profileDecoderTest) {
+	t.Helper()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := decoder([]byte(test.input))
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %#v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got  %#v\nwant %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDecodeYAMLProfile(t *testing.T) {
+	runProfileDecoderTests(t, decodeYAMLProfile, []profileDecoderTest{
+		{
+			name:  "quoting",
+			input: "a: \"x: #y\"\nb: 'it''s'\nc: plain text\n\"d e\": \"tab\\tnewline\\n\"\nf: ''\n",
+			want:  map[string]interface{}{"a": "x: #y", "b": "it's", "c": "plain text", "d e": "tab\tnewline\n", "f": ""},
+		},
+		{
+			name:  "comments",
+			input: "# header\n---\na: 1 # trailing\nb: key#not-comment\n  # indented comment\nc: \"#\"\n",
+			want:  map[string]interface{}{"a": json.Number("1"), "b": "key#not-comment", "c": "#"},
+		},
+		{
+			name:  "nesting",
+			input: "profiles:\n  prod:\n    options:\n      accessKey: ak\n    bucket: assets\n  dev:\n    bucket: test\nempty:\nlast: x\n",
+			want: map[string]interface{}{
+				"profiles": map[string]interface{}{
+					"prod": map[string]interface{}{
+						"options": map[string]interface{}{"accessKey": "ak"},
+						"bucket":  "assets",
+					},
+					"dev": map[string]interface{}{"bucket": "test"},
+				},
+				"empty": nil,
+				"last":  "x",
+			},
+		},
+		{
+			name:  "scalars",
+			input: "appId: 1250000000\nbig: 12345678901234567890\nnegative: -3\nfloat: 1.5\nexp: 1e3\nzero: 01\nunderscore: 1_000\nyes: true\nno: false\nnull: null\ntilde: ~\nquoted: \"42\"\n",
+			want: map[string]interface{}{
+				"appId":      json.Number("1250000000"),
+				"big":        json.Number("12345678901234567890"),
+				"negative":   json.Number("-3"),
+				"float":      json.Number("1.5"),
+				"exp":        json.Number("1e3"),
+				"zero":       "01",
+				"underscore": "1_000",
+				"yes":        true,
+				"no":         false,
+				"null":       nil,
+				"tilde":      nil,
+				"quoted":     "42",
+			},
+		},
+		{name: "tab indentation", input: "a:\n\tb: 1\n", wantErr: true},
+		{name: "list", input: "a:\n  - b\n", wantErr: true},
+		{name: "bad indentation", input: "a:\n    b: 1\n  c: 2\n", wantErr: true},
+		{name: "missing separator", input: "a\n", wantErr: true},
+		{name: "flow mapping", input: "a: {b: 1}\n", wantErr: true},
+		{name: "unterminated quote", input: "a: 'b\n", wantErr: true},
+	})
+}
+
+func TestDecodeTOMLProfile(t *testing.T) {
+	runProfileDecoderTests(t, decodeTOMLProfile, []profileDecoderTest{
+		{
+			name:  "quoting",
+			input: "a = \"x = #y\"\nb = 'c:\\path'\n\"d.e\" = \"f\"\n",
+			want:  map[string]interface{}{"a": "x = #y", "b": `c:\path`, "d.e": "f"},
+		},
+		{
+			name:  "comments",
+			input: "# header\n\na = 1 # trailing\n  # indented\nb = \"#\"\n",
+			want:  map[string]interface{}{"a": json.Number("1"), "b": "#"},
+		},
+		{
+			name:  "nesting",
+			input: "[profiles.prod]\nbucket = \"assets\"\noptions.accessKey = \"ak\"\n\n[profiles.prod.options]\nsecretKey = \"sk\"\n\n[profiles.\"dev.local\"]\nbucket = \"test\"\n",
+			want: map[string]interface{}{
+				"profiles": map[string]interface{}{
+					"prod": map[string]interface{}{
+						"bucket":  "assets",
+						"options": map[string]interface{}{"accessKey": "ak", "secretKey": "sk"},
+					},
+					"dev.local": map[string]interface{}{"bucket": "test"},
+				},
+			},
+		},
+		{
+			name:  "scalars",
+			input: "appId = 1250000000\nfloat = 0.5\nnegative = -7\nzero = 01\nyes = true\nquoted = \"42\"\n",
+			want: map[string]interface{}{
+				"appId":    json.Number("1250000000"),
+				"float":    json.Number("0.5"),
+				"negative": json.Number("-7"),
+				"zero":     "01",
+				"yes":      true,
+				"quoted":   "42",
+			},
+		},
+		{name: "array", input: "a = [1, 2]\n", wantErr: true},
+		{name: "inline table", input: "a = {b = 1}\n", wantErr: true},
+		{name: "array of tables", input: "[[a]]\n", wantErr: true},
+		{name: "missing separator", input: "a\n", wantErr: true},
+		{name: "key is not a table", input: "a = 1\n[a.b]\n", wantErr: true},
+	})
+}
+
+func TestExpandProfileEnv(t *testing.T) {
+	os.Setenv("PROFILE_TEST_SET", "value")
+	os.Setenv("PROFILE_TEST_EMPTY", "")
+	defer os.Unsetenv("PROFILE_TEST_SET")
+	defer os.Unsetenv("PROFILE_TEST_EMPTY")
+	os.Unsetenv("PROFILE_TEST_UNSET")
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "${PROFILE_TEST_SET}", want: "value"},
+		{input: "a-${PROFILE_TEST_SET}-b", want: "a-value-b"},
+		{input: "${PROFILE_TEST_SET:-default}", want: "value"},
+		{input: "${PROFILE_TEST_EMPTY}", want: ""},
+		{input: "${PROFILE_TEST_EMPTY:-default}", want: ""},
+		{input: "${PROFILE_TEST_UNSET:-default}", want: "default"},
+		{input: "${PROFILE_TEST_UNSET:-}", want: ""},
+		{input: "$PROFILE_TEST_SET and $$ stay", want: "$PROFILE_TEST_SET and $$ stay"},
+		{input: "${PROFILE_TEST_UNSET}", wantErr: true},
+		{input: "ok ${PROFILE_TEST_SET} ${PROFILE_TEST_UNSET}", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := expandProfileEnv(test.input)
+		if test.wantErr {
+			if !errors.Is(err, ErrProfileEnvNotSet) {
+				t.Errorf("%s: err = %v, want ErrProfileEnvNotSet", test.input, err)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("%s = %#v, %v, want %#v", test.input, got, err, test.want)
+		}
+	}
+
+	nested := map[string]interface{}{
+		"options": map[string]interface{}{"secretKey": "${PROFILE_TEST_SET}", "appId": json.Number("1")},
+		"list":    []interface{}{"${PROFILE_TEST_SET}", true},
+	}
+	got, err := expandProfileEnv(nested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"options": map[string]interface{}{"secretKey": "value", "appId": json.Number("1")},
+		"list":    []interface{}{"value", true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("nested = %#v", got)
+	}
+	nested["options"].(map[string]interface{})["accessKey"] = "${PROFILE_TEST_UNSET}"
+	if _, err := expandProfileEnv(nested); !errors.Is(err, ErrProfileEnvNotSet) {
+		t.Errorf("nested missing variable = %v", err)
+	}
+}
+
+func writeProfileFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	filename := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+// 没有加引号的数字配置项不能被当作 float64 拒绝
+func TestLoadProfilesNumericOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("PROFILE_TEST_SECRET", "sk")
+	defer os.Unsetenv("PROFILE_TEST_SECRET")
+	files := map[string]string{
+		"profiles.yaml": `
+profiles:
+  cos:
+    provider: " tencent "
+    bucket: 2024
+    region: ap-guangzhou
+    options:
+      appId: 1250000000
+      accessKey: 123456
+      secretKey: ${PROFILE_TEST_SECRET}
+      timeout: 30
+`,
+		"profiles.toml": `
+[profiles.cos]
+provider = "tencent"
+bucket = 2024
+region = "ap-guangzhou"
+
+[profiles.cos.options]
+appId = 1250000000
+accessKey = 123456
+secretKey = "${PROFILE_TEST_SECRET}"
+timeout = 30
+`,
+		"profiles.json": `{"profiles": {"cos": {"provider": "tencent", "bucket": 2024, "region": "ap-guangzhou",
+"options": {"appId": 1250000000, "accessKey": 123456, "secretKey": "${PROFILE_TEST_SECRET}", "timeout": 30}}}}`,
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			profiles, err := LoadProfiles(writeProfileFile(t, dir, name, content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			profile := profiles["cos"]
+			if profile == nil || profile.Name != "cos" || profile.Provider != "tencent" || profile.Bucket != "2024" || profile.Region != "ap-guangzhou" {
+				t.Fatalf("profile = %+v", profile)
+			}
+			cfg, err := DecodeConfig(profile.Provider, profile.Options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tencentConfig := cfg.(TencentConfig)
+			if tencentConfig.AppId != "1250000000" || tencentConfig.AccessKey != "123456" || tencentConfig.SecretKey != "sk" || tencentConfig.Timeout != 30*time.Second {
+				t.Errorf("config = %+v", tencentConfig)
+			}
+		})
+	}
+}
+
+func TestLoadProfilesErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Unsetenv("PROFILE_TEST_UNSET")
+	tests := []struct {
+		name    string
+		content string
+		wantErr error
+	}{
+		{name: "unknown.ini", content: "", wantErr: ErrUnsupportedProfileExt},
+		{name: "empty-provider.yaml", content: "profiles:\n  a:\n    bucket: b\n", wantErr: ErrEmptyProfileProvider},
+		{name: "null-profile.yaml", content: "profiles:\n  a:\n", wantErr: ErrEmptyProfileProvider},
+		{name: "missing-env.toml", content: "[profiles.a]\nprovider = \"${PROFILE_TEST_UNSET}\"\n", wantErr: ErrProfileEnvNotSet},
+		{name: "bucket-map.yaml", content: "profiles:\n  a:\n    provider: local\n    bucket:\n      b: c\n"},
+	}
+	for _, test := range tests {
+		_, err := LoadProfiles(writeProfileFile(t, dir, test.name, test.content))
+		if err == nil || (test.wantErr != nil && !errors.Is(err, test.wantErr)) {
+			t.Errorf("%s: err = %v, want %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestLoadProfileClients(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	content := strings.NewReplacer("{dir}", filepath.ToSlash(dir)).Replace(`
+profiles:
+  files:
+    provider: local
+    bucket: 2024
+    region: local-1
+    options:
+      tempDir: "{dir}/temp"
+      storageDir: "{dir}/storage"
+`)
+	clients, err := LoadProfileClients(writeProfileFile(t, dir, "profiles.yml", content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := clients["files"]
+	if client == nil || client.Name != "files" || client.Bucket != "2024" || client.Region != "local-1" || client.Client == nil {
+		t.Fatalf("client = %+v", client)
+	}
+	defer client.Client.Close()
+	if _, err := client.Client.PutObject(client.Bucket, client.Region, "key", strings.NewReader("data"), 4, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Client.StatObject(client.Bucket, client.Region, "key"); err != nil {
+		t.Error(err)
+	}
+
+	bad := writeProfileFile(t, dir, "bad.yml", "profiles:\n  broken:\n    provider: local\n")
+	if _, err := LoadProfileClients(bad); err == nil || !strings.Contains(err.Error(), "profile broken") {
+		t.Errorf("err = %v", err)
+	}
+}
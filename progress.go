@@ -0,0 +1,211 @@
+package go_cover_storage
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 上传进度事件类型
+type ProgressEventType int
+
+const (
+	// 开始上传分片
+	PartStartedEvent ProgressEventType = iota
+	// 分片发送了新的数据
+	PartDataEvent
+	// 分片上传成功
+	PartFinishedEvent
+	// 分片上传失败，Uploader 重试时会再次收到 PartStartedEvent
+	PartFailedEvent
+)
+
+// 上传进度事件
+type ProgressEvent struct {
+	Type       ProgressEventType
+	Provider   string
+	Bucket     string
+	Key        string
+	UploadId   string
+	PartNumber uint
+	PartSize   int64
+	// 本分片已发送的字节数
+	PartSentBytes int64
+	// 已发送和总字节数，直接调用客户端时为本分片的数据，通过 Uploader 上传时为整个上传，总大小未知时 TotalBytes 为 -1
+	SentBytes  int64
+	TotalBytes int64
+	// 按平均速度估计的剩余时间，无法估计时为 0
+	ETA time.Duration
+	// PartFinishedEvent 时为分片的上传结果
+	Result *UploadPartResult
+	// PartFailedEvent 时为失败原因
+	Err error
+}
+
+// 进度回调，并发上传分片时会在多个 goroutine 中同时调用，不能阻塞
+type ProgressListener func(event *ProgressEvent)
+
+type progressContextKey struct{}
+
+// 返回带有进度回调的 ctx，使用该 ctx 调用各客户端的 MultipartUploadPart 系列方法时触发进度事件
+func WithProgress(ctx context.Context, listener ProgressListener) context.Context {
+	return context.WithValue(ctx, progressContextKey{}, listener)
+}
+
+func progressListenerFromContext(ctx context.Context) ProgressListener {
+	listener, _ := ctx.Value(progressContextKey{}).(ProgressListener)
+	return listener
+}
+
+// 按已用时间和进度估计剩余时间
+func estimateETA(elapsed time.Duration, sent, total int64) time.Duration {
+	if sent <= 0 || total <= 0 || sent >= total {
+		return 0
+	}
+	return time.Duration(float64(elapsed) * float64(total-sent) / float64(sent))
+}
+
+// 单个分片的上传进度，ctx 中没有进度回调时为 nil，方法都可以在 nil 上调用
+type partProgress struct {
+	listener ProgressListener
+	event    ProgressEvent
+	start    time.Time
+	sent     int64
+}
+
+// 各客户端上传分片前调用，触发 PartStartedEvent
+func startPartProgress(ctx context.Context, provider, bucketName, objectKey, uploadId string, partNumber uint, size int64) *partProgress {
+	listener := progressListenerFromContext(ctx)
+	if listener == nil {
+		return nil
+	}
+	p := &partProgress{
+		listener: listener,
+		event: ProgressEvent{
+			Provider:   provider,
+			Bucket:     bucketName,
+			Key:        objectKey,
+			UploadId:   uploadId,
+			PartNumber: partNumber,
+			PartSize:   size,
+			TotalBytes: size,
+		},
+		start: time.Now(),
+	}
+	p.fire(PartStartedEvent, 0, nil, nil)
+	return p
+}
+
+func (p *partProgress) fire(eventType ProgressEventType, sent int64, result *UploadPartResult, err error) {
+	event := p.event
+	event.Type = eventType
+	event.PartSentBytes = sent
+	event.SentBytes = sent
+	event.ETA = estimateETA(time.Since(p.start), sent, event.TotalBytes)
+	event.Result = result
+	event.Err = err
+	p.listener(&event)
+}
+
+// 统计从 reader 读取的数据，SDK 读取请求体时触发 PartDataEvent
+func (p *partProgress) reader(reader io.Reader) io.Reader {
+	if p == nil {
+		return reader
+	}
+	return &progressReader{reader: reader, progress: p}
+}
+
+func (p *partProgress) add(n int64) {
+	if p == nil || n <= 0 {
+		return
+	}
+	p.fire(PartDataEvent, atomic.AddInt64(&p.sent, n), nil, nil)
+}
+
+// SDK 自己统计进度时使用，consumed 为累计发送的字节数
+func (p *partProgress) set(consumed int64) {
+	if p == nil {
+		return
+	}
+	if previous := atomic.SwapInt64(&p.sent, consumed); previous != consumed {
+		p.fire(PartDataEvent, consumed, nil, nil)
+	}
+}
+
+// 分片上传结束后调用，触发 PartFinishedEvent 或 PartFailedEvent
+func (p *partProgress) finish(result *UploadPartResult, err error) {
+	if p == nil {
+		return
+	}
+	if err != nil {
+		p.fire(PartFailedEvent, atomic.LoadInt64(&p.sent), nil, err)
+		return
+	}
+	p.fire(PartFinishedEvent, p.event.PartSize, result, nil)
+}
+
+type progressReader struct {
+	reader   io.Reader
+	progress *partProgress
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.progress.add(int64(n))
+	return n, err
+}
+
+// Uploader 汇总各分片的进度，计算整个上传的已发送字节数和剩余时间
+type uploadProgress struct {
+	listener ProgressListener
+	total    int64
+	start    time.Time
+
+	mu sync.Mutex
+	// 已完成分片和进行中分片已发送的字节数
+	sent     int64
+	partSent map[uint]int64
+}
+
+func newUploadProgress(listener ProgressListener, total int64) *uploadProgress {
+	return &uploadProgress{
+		listener: listener,
+		total:    total,
+		start:    time.Now(),
+		partSent: make(map[uint]int64),
+	}
+}
+
+// 断点续传时跳过的分片计入已发送
+func (p *uploadProgress) skip(size int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.sent += size
+	p.mu.Unlock()
+}
+
+func (p *uploadProgress) handle(event *ProgressEvent) {
+	p.mu.Lock()
+	previous := p.partSent[event.PartNumber]
+	switch event.Type {
+	case PartStartedEvent, PartFailedEvent:
+		// 失败的分片会重新上传，之前发送的数据不再计入
+		p.sent -= previous
+		delete(p.partSent, event.PartNumber)
+	default:
+		p.sent += event.PartSentBytes - previous
+		p.partSent[event.PartNumber] = event.PartSentBytes
+	}
+	if event.Type == PartFinishedEvent {
+		delete(p.partSent, event.PartNumber)
+	}
+	event.SentBytes = p.sent
+	p.mu.Unlock()
+	event.TotalBytes = p.total
+	event.ETA = estimateETA(time.Since(p.start), event.SentBytes, p.total)
+	p.listener(event)
+}
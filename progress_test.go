@@ -0,0 +1,196 @@
+package go_cover_storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// 记录收到的进度事件
+type progressRecorder struct {
+	mu     sync.Mutex
+	events []ProgressEvent
+}
+
+func (r *progressRecorder) listener(event *ProgressEvent) {
+	r.mu.Lock()
+	r.events = append(r.events, *event)
+	r.mu.Unlock()
+}
+
+func (r *progressRecorder) recorded() []ProgressEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]ProgressEvent(nil), r.events...)
+}
+
+func TestUploadProgressAggregation(t *testing.T) {
+	recorder := &progressRecorder{}
+	progress := newUploadProgress(recorder.listener, 100)
+	// 断点续传跳过的分片
+	progress.skip(30)
+	steps := []struct {
+		event ProgressEvent
+		sent  int64
+	}{
+		{ProgressEvent{Type: PartStartedEvent, PartNumber: 2}, 30},
+		{ProgressEvent{Type: PartDataEvent, PartNumber: 2, PartSentBytes: 10}, 40},
+		{ProgressEvent{Type: PartStartedEvent, PartNumber: 3}, 40},
+		{ProgressEvent{Type: PartDataEvent, PartNumber: 3, PartSentBytes: 5}, 45},
+		{ProgressEvent{Type: PartDataEvent, PartNumber: 2, PartSentBytes: 20}, 55},
+		// 失败的分片之前发送的数据不再计入
+		{ProgressEvent{Type: PartFailedEvent, PartNumber: 2, PartSentBytes: 20}, 35},
+		{ProgressEvent{Type: PartStartedEvent, PartNumber: 2}, 35},
+		{ProgressEvent{Type: PartDataEvent, PartNumber: 2, PartSentBytes: 35}, 70},
+		{ProgressEvent{Type: PartFinishedEvent, PartNumber: 2, PartSentBytes: 35}, 70},
+		{ProgressEvent{Type: PartFinishedEvent, PartNumber: 3, PartSentBytes: 30}, 95},
+	}
+	for i, step := range steps {
+		event := step.event
+		progress.handle(&event)
+		if event.SentBytes != step.sent || event.TotalBytes != 100 {
+			t.Errorf("step %d: sent %d/%d, want %d/100", i, event.SentBytes, event.TotalBytes, step.sent)
+		}
+	}
+	events := recorder.recorded()
+	if len(events) != len(steps) {
+		t.Fatalf("%d events, want %d", len(events), len(steps))
+	}
+	for i, event := range events {
+		if event.Type != steps[i].event.Type || event.PartNumber != steps[i].event.PartNumber {
+			t.Errorf("event %d = %v part %d, want %v part %d", i, event.Type, event.PartNumber, steps[i].event.Type, steps[i].event.PartNumber)
+		}
+	}
+	if len(progress.partSent) != 0 {
+		t.Errorf("unfinished parts = %v", progress.partSent)
+	}
+}
+
+// 检查单个分片的事件顺序：PartStartedEvent、若干 PartDataEvent，最后为 PartFinishedEvent 或 PartFailedEvent
+func checkPartEvents(t *testing.T, events []ProgressEvent, last ProgressEventType, size int64) {
+	t.Helper()
+	if len(events) < 2 {
+		t.Fatalf("%d events", len(events))
+	}
+	if events[0].Type != PartStartedEvent || events[0].PartSentBytes != 0 {
+		t.Errorf("first event = %v, sent %d", events[0].Type, events[0].PartSentBytes)
+	}
+	var sent int64
+	for i, event := range events[1 : len(events)-1] {
+		if event.Type != PartDataEvent || event.PartSentBytes <= sent {
+			t.Errorf("event %d = %v, sent %d after %d", i+1, event.Type, event.PartSentBytes, sent)
+		}
+		sent = event.PartSentBytes
+	}
+	if end := events[len(events)-1]; end.Type != last || end.PartSentBytes != size {
+		t.Errorf("last event = %v, sent %d, want %v, sent %d", end.Type, end.PartSentBytes, last, size)
+	}
+}
+
+func TestWithProgress(t *testing.T) {
+	client, cleanup := newTestLocalClient(t)
+	defer cleanup()
+	content := testContent(1 << 20)
+	uploadId, err := client.MultipartUploadInit("bucket", "", "progress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.MultipartUploadAbort("bucket", "", "progress", uploadId)
+
+	// ctx 中没有进度回调时不触发事件
+	if startPartProgress(context.Background(), "local", "bucket", "progress", uploadId, 1, 1) != nil {
+		t.Error("progress without listener")
+	}
+
+	recorder := &progressRecorder{}
+	ctx := WithProgress(context.Background(), recorder.listener)
+	result, err := client.MultipartUploadPartFromReaderWithContext(ctx, "bucket", "", "progress", uploadId, 1, bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := recorder.recorded()
+	checkPartEvents(t, events, PartFinishedEvent, int64(len(content)))
+	for _, event := range events {
+		if event.Provider != "local" || event.UploadId != uploadId || event.PartNumber != 1 || event.PartSize != int64(len(content)) {
+			t.Fatalf("event = %+v", event)
+		}
+		// 直接调用客户端时 SentBytes 和 TotalBytes 为本分片的数据
+		if event.SentBytes != event.PartSentBytes || event.TotalBytes != int64(len(content)) {
+			t.Errorf("sent %d/%d, part sent %d", event.SentBytes, event.TotalBytes, event.PartSentBytes)
+		}
+	}
+	if end := events[len(events)-1]; end.Result == nil || end.Result.ETag != result.ETag {
+		t.Errorf("result = %+v, want %+v", end.Result, result)
+	}
+
+	// 读取失败时触发 PartFailedEvent
+	recorder = &progressRecorder{}
+	ctx = WithProgress(context.Background(), recorder.listener)
+	readErr := errors.New("read failed")
+	reader := &failingReader{data: content[:1000], err: readErr}
+	if _, err = client.MultipartUploadPartFromReaderWithContext(ctx, "bucket", "", "progress", uploadId, 2, reader, int64(len(content))); err == nil {
+		t.Fatal("upload part should fail")
+	}
+	events = recorder.recorded()
+	checkPartEvents(t, events, PartFailedEvent, 1000)
+	if end := events[len(events)-1]; !errors.Is(end.Err, readErr) {
+		t.Errorf("err = %v", end.Err)
+	}
+}
+
+// 读完 data 后返回 err
+type failingReader struct {
+	data []byte
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestUploaderProgress(t *testing.T) {
+	client, cleanup := newTestLocalClient(t)
+	defer cleanup()
+	content := testContent(12 << 20)
+	for name, size := range map[string]int64{"known size": int64(len(content)), "unknown size": -1} {
+		t.Run(name, func(t *testing.T) {
+			recorder := &progressRecorder{}
+			uploader := &Uploader{Client: client, PartSize: minUploadPartSize, Concurrency: 1, Progress: recorder.listener}
+			if _, err := uploader.Upload(context.Background(), "bucket", "", "progress", &streamReader{bytes.NewReader(content)}, size, nil); err != nil {
+				t.Fatal(err)
+			}
+			events := recorder.recorded()
+			// 只有一个并发时分片依次上传，SentBytes 不会减少
+			var sent int64
+			parts := make(map[uint][]ProgressEvent)
+			for i, event := range events {
+				if event.SentBytes < sent || event.TotalBytes != size {
+					t.Fatalf("event %d: sent %d/%d after %d", i, event.SentBytes, event.TotalBytes, sent)
+				}
+				sent = event.SentBytes
+				parts[event.PartNumber] = append(parts[event.PartNumber], event)
+			}
+			if sent != int64(len(content)) {
+				t.Errorf("sent %d, want %d", sent, len(content))
+			}
+			if len(parts) != 3 {
+				t.Fatalf("%d parts", len(parts))
+			}
+			for partNumber, partEvents := range parts {
+				partSize := int64(minUploadPartSize)
+				if partNumber == 3 {
+					partSize = int64(len(content)) - 2*minUploadPartSize
+				}
+				checkPartEvents(t, partEvents, PartFinishedEvent, partSize)
+			}
+		})
+	}
+	checkNoUploads(t, client)
+}
@@ -4,17 +4,42 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/qiniu/go-sdk/v7/auth"
 	"github.com/qiniu/go-sdk/v7/auth/qbox"
+	"github.com/qiniu/go-sdk/v7/client"
 	"github.com/qiniu/go-sdk/v7/conf"
 	"github.com/qiniu/go-sdk/v7/storage"
+	"io"
 	"net/http"
+	"net/url"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // 七牛云存储 kodo
 type qiniu struct {
 	accessKey, secretKey string
+	downloadDomain       string
+	connOptions
+	cache *clientCache
+}
+
+func init() {
+	Qiniu = &qiniu{}
+	mustRegisterProvider("qiniu", Qiniu.Init)
+}
+
+// timeout 为 0 时不限制
+func (q *qiniu) getHttpClient() *http.Client {
+	return &http.Client{Transport: q.cache.transport(), Timeout: q.timeout}
+}
+
+func (q *qiniu) getKodoClient() *client.Client {
+	return &client.Client{Client: q.getHttpClient()}
 }
 
 type uploadPartInfo struct {
@@ -29,12 +54,10 @@ type rputV2Extra struct {
 	Metadata   map[string]string // 可选。用户自定义文件 metadata 信息
 	CustomVars map[string]string // 可选。用户自定义参数，以"x:"开头，而且值不能为空，否则忽略
 	UpHost     string
-	MimeType   string                                              // 可选。
-	PartSize   int64                                               // 可选。每次上传的块大小
-	TryTimes   int                                                 // 可选。尝试次数
-	Progress   []uploadPartInfo                                    // 上传进度
-	Notify     func(partNumber int64, ret *storage.UploadPartsRet) // 可选。进度提示（注意多个block是并行传输的）
-	NotifyErr  func(partNumber int64, err error)
+	MimeType   string           // 可选。
+	PartSize   int64            // 可选。每次上传的块大小
+	TryTimes   int              // 可选。尝试次数
+	Progress   []uploadPartInfo // 上传进度
 }
 
 func encodeV2(key string, hasKey bool) string {
@@ -81,74 +104,150 @@ func completeParts(resumeUploaderV2 *storage.ResumeUploaderV2, ctx context.Conte
 	return resumeUploaderV2.Client.CallWithJson(ctx, ret, "POST", reqUrl, makeHeadersForUploadEx(upToken, conf.CONTENT_TYPE_JSON), &completePartBody)
 }
 
-func (q *qiniu) getKodoResumeUploaderV2(bucketName string) (string, string, *storage.ResumeUploaderV2, error) {
+func abortParts(resumeUploaderV2 *storage.ResumeUploaderV2, ctx context.Context, upToken, upHost, bucket, key string, hasKey bool, uploadId string) error {
+	reqUrl := upHost + "/buckets/" + bucket + "/objects/" + encodeV2(key, hasKey) + "/uploads/" + uploadId
+
+	return resumeUploaderV2.Client.Call(ctx, nil, "DELETE", reqUrl, makeHeadersForUploadEx(upToken, ""))
+}
+
+type listPartsRet struct {
+	UploadId         string `json:"uploadId"`
+	ExpireAt         int64  `json:"expireAt"`
+	PartNumberMarker int64  `json:"partNumberMarker"` // 下次列举的起始位置，为 0 表示已列举完
+	Parts            []struct {
+		Size       int64  `json:"size"`
+		Etag       string `json:"etag"`
+		PartNumber int64  `json:"partNumber"`
+		PutTime    int64  `json:"putTime"`
+	} `json:"parts"`
+}
+
+func listParts(resumeUploaderV2 *storage.ResumeUploaderV2, ctx context.Context, upToken, upHost string, ret *listPartsRet, bucket, key string, hasKey bool, uploadId string, partNumberMarker int64) error {
+	reqUrl := upHost + "/buckets/" + bucket + "/objects/" + encodeV2(key, hasKey) + "/uploads/" + uploadId
+	if partNumberMarker > 0 {
+		reqUrl += "?part-number-marker=" + strconv.FormatInt(partNumberMarker, 10)
+	}
+
+	return resumeUploaderV2.Client.Call(ctx, ret, "GET", reqUrl, makeHeadersForUploadEx(upToken, ""))
+}
+
+// scope 为 bucket 时只能新增文件，为 bucket:key 时允许覆盖同名文件
+func (q *qiniu) getUploadToken(scope string) string {
 	putPolicy := storage.PutPolicy{
-		Scope: bucketName,
+		Scope: scope,
 	}
 	mac := qbox.NewMac(q.accessKey, q.secretKey)
-	upToken := putPolicy.UploadToken(mac)
+	return putPolicy.UploadToken(mac)
+}
+
+// region 为七牛的机房 id，如 z0，为空或不认识时查询空间所在的机房
+func (q *qiniu) getKodoConfig(bucketName, region string) (*storage.Config, error) {
 	cfg := storage.Config{}
-	// 空间对应的机房
-	region, err := storage.GetRegion(q.accessKey, bucketName)
+	regionID := q.getRegion(region)
+	// 查询机房需要请求网络，按机房和空间缓存
+	kodoRegion, err := q.cache.get(cacheKey("region", regionID, bucketName), func() (interface{}, error) {
+		if kodoRegion, ok := storage.GetRegionByID(storage.RegionID(regionID)); ok {
+			return &kodoRegion, nil
+		}
+		return storage.GetRegion(q.accessKey, bucketName)
+	})
 	if err != nil {
-		return "", "", nil, err
+		return nil, err
 	}
-	cfg.Region = region
+	cfg.Region = kodoRegion.(*storage.Region)
+	// 上传域名使用同一个机房，不再查询
+	cfg.Zone = cfg.Region
 	// 是否使用https域名
-	cfg.UseHTTPS = true
+	cfg.UseHTTPS = q.getScheme("https") == "https"
 	// 上传是否使用CDN上传加速
 	cfg.UseCdnDomains = false
-	resumeUploader := storage.NewResumeUploaderV2(&cfg)
-	upHost, err := resumeUploader.UpHost(q.accessKey, bucketName)
+	return &cfg, nil
+}
+
+func (q *qiniu) getKodoResumeUploaderV2(bucketName, region string) (string, string, *storage.ResumeUploaderV2, error) {
+	upToken := q.getUploadToken(bucketName)
+	cfg, err := q.getKodoConfig(bucketName, region)
 	if err != nil {
 		return "", "", nil, err
 	}
-	return upToken, upHost, resumeUploader, nil
+	resumeUploader := storage.NewResumeUploaderV2Ex(cfg, q.getKodoClient())
+	// 按机房和空间缓存
+	upHost, err := q.cache.get(cacheKey("upHost", q.getRegion(region), bucketName), func() (interface{}, error) {
+		return resumeUploader.UpHost(q.accessKey, bucketName)
+	})
+	if err != nil {
+		return "", "", nil, err
+	}
+	return upToken, upHost.(string), resumeUploader, nil
+}
+
+func (q *qiniu) Close() error {
+	q.cache.close()
+	return nil
 }
 
 func (q *qiniu) Init(options map[string]interface{}) (StoreClient, error) {
-	accessKey, secretKey, err := getAccessKeySecretKey(options)
-	if err != nil {
-		return nil, err
-	}
-	return &qiniu{
-		accessKey: accessKey,
-		secretKey: secretKey,
-	}, nil
+	return initClient("qiniu", options)
 }
 
 func (q *qiniu) MultipartUploadInit(bucketName, region, objectKey string) (string, error) {
-	upToken, upHost, resumeUploaderV2, err := q.getKodoResumeUploaderV2(bucketName)
+	return q.MultipartUploadInitWithContext(context.Background(), bucketName, region, objectKey)
+}
+
+func (q *qiniu) MultipartUploadInitWithContext(ctx context.Context, bucketName, region, objectKey string) (string, error) {
+	upToken, upHost, resumeUploaderV2, err := q.getKodoResumeUploaderV2(bucketName, region)
 	if err != nil {
 		return "", err
 	}
 	result := &storage.InitPartsRet{}
-	err = resumeUploaderV2.InitParts(context.Background(), upToken, upHost, bucketName, objectKey, true, result)
+	err = resumeUploaderV2.InitParts(ctx, upToken, upHost, bucketName, objectKey, true, result)
 	if err != nil {
 		return "", err
 	}
 	return result.UploadID, nil
 }
 
-func (q *qiniu) MultipartUploadPart(bucketName, region, objectKey, uploadId string, partNumber uint, body []byte) (H, error) {
-	upToken, upHost, resumeUploaderV2, err := q.getKodoResumeUploaderV2(bucketName)
+func (q *qiniu) MultipartUploadPart(bucketName, region, objectKey, uploadId string, partNumber uint, body []byte) (*UploadPartResult, error) {
+	return q.MultipartUploadPartWithContext(context.Background(), bucketName, region, objectKey, uploadId, partNumber, body)
+}
+
+func (q *qiniu) MultipartUploadPartWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string, partNumber uint, body []byte) (*UploadPartResult, error) {
+	return q.MultipartUploadPartFromReaderWithContext(ctx, bucketName, region, objectKey, uploadId, partNumber, bytes.NewReader(body), int64(len(body)))
+}
+
+func (q *qiniu) MultipartUploadPartFromReader(bucketName, region, objectKey, uploadId string, partNumber uint, reader io.Reader, size int64) (*UploadPartResult, error) {
+	return q.MultipartUploadPartFromReaderWithContext(context.Background(), bucketName, region, objectKey, uploadId, partNumber, reader, size)
+}
+
+func (q *qiniu) MultipartUploadPartFromReaderWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string, partNumber uint, reader io.Reader, size int64) (*UploadPartResult, error) {
+	upToken, upHost, resumeUploaderV2, err := q.getKodoResumeUploaderV2(bucketName, region)
 	if err != nil {
 		return nil, err
 	}
-	result := &storage.UploadPartsRet{}
-	fd := bytes.NewReader(body)
-	err = resumeUploaderV2.UploadParts(context.Background(), upToken, upHost, bucketName, objectKey, true, uploadId, int64(partNumber), "", result, fd, fd.Len())
+	ret := &storage.UploadPartsRet{}
+	progress := startPartProgress(ctx, "qiniu", bucketName, objectKey, uploadId, partNumber, size)
+	checksumReader := newChecksumReader(io.LimitReader(reader, size))
+	err = resumeUploaderV2.UploadParts(ctx, upToken, upHost, bucketName, objectKey, true, uploadId, int64(partNumber), "", ret, progress.reader(checksumReader), int(size))
 	if err != nil {
+		progress.finish(nil, err)
 		return nil, err
 	}
-	return H{
-		"PartNumber": int(partNumber),
-		"ETag":       result.Etag,
-	}, nil
+	result := &UploadPartResult{
+		PartNumber: partNumber,
+		ETag:       ret.Etag,
+		Size:       size,
+		Checksum:   checksumReader.Checksum(),
+	}
+	progress.finish(result, nil)
+	return result, nil
 }
 
-func (q *qiniu) MultipartUploadComplete(bucketName, region, objectKey, uploadId string, parts map[uint]string) (H, error) {
-	upToken, upHost, resumeUploaderV2, err := q.getKodoResumeUploaderV2(bucketName)
+func (q *qiniu) MultipartUploadComplete(bucketName, region, objectKey, uploadId string, parts map[uint]string) (*CompleteResult, error) {
+	return q.MultipartUploadCompleteWithContext(context.Background(), bucketName, region, objectKey, uploadId, parts)
+}
+
+func (q *qiniu) MultipartUploadCompleteWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string, parts map[uint]string) (*CompleteResult, error) {
+	upToken, upHost, resumeUploaderV2, err := q.getKodoResumeUploaderV2(bucketName, region)
 	if err != nil {
 		return nil, err
 	}
@@ -166,11 +265,503 @@ func (q *qiniu) MultipartUploadComplete(bucketName, region, objectKey, uploadId
 	putExtra := rputV2Extra{
 		Progress: inputParts,
 	}
-	err = completeParts(resumeUploaderV2, context.Background(), upToken, upHost, &result, bucketName, objectKey, true, uploadId, &putExtra)
+	err = completeParts(resumeUploaderV2, ctx, upToken, upHost, &result, bucketName, objectKey, true, uploadId, &putExtra)
+	if err != nil {
+		return nil, err
+	}
+	return &CompleteResult{
+		Bucket: bucketName,
+		Key:    result.Key,
+		ETag:   result.Hash,
+	}, nil
+}
+
+func (q *qiniu) MultipartUploadAbort(bucketName, region, objectKey, uploadId string) error {
+	return q.MultipartUploadAbortWithContext(context.Background(), bucketName, region, objectKey, uploadId)
+}
+
+func (q *qiniu) MultipartUploadAbortWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string) error {
+	upToken, upHost, resumeUploaderV2, err := q.getKodoResumeUploaderV2(bucketName, region)
+	if err != nil {
+		return err
+	}
+	return abortParts(resumeUploaderV2, ctx, upToken, upHost, bucketName, objectKey, true, uploadId)
+}
+
+func (q *qiniu) MultipartUploadListParts(bucketName, region, objectKey, uploadId string) ([]Part, error) {
+	return q.MultipartUploadListPartsWithContext(context.Background(), bucketName, region, objectKey, uploadId)
+}
+
+func (q *qiniu) MultipartUploadListPartsWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string) ([]Part, error) {
+	upToken, upHost, resumeUploaderV2, err := q.getKodoResumeUploaderV2(bucketName, region)
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]Part, 0)
+	var marker int64
+	for {
+		result := &listPartsRet{}
+		err = listParts(resumeUploaderV2, ctx, upToken, upHost, result, bucketName, objectKey, true, uploadId, marker)
+		if err != nil {
+			return nil, err
+		}
+		for _, part := range result.Parts {
+			parts = append(parts, Part{
+				PartNumber:   int(part.PartNumber),
+				ETag:         part.Etag,
+				Size:         part.Size,
+				LastModified: time.Unix(part.PutTime, 0),
+			})
+		}
+		if result.PartNumberMarker == 0 {
+			return parts, nil
+		}
+		marker = result.PartNumberMarker
+	}
+}
+
+// kodo 原生接口不支持列举分片上传，通过兼容 S3 的接口实现，region 必须传空间所在区域
+func (q *qiniu) ListMultipartUploads(bucketName, region, prefix, marker string, maxUploads int) (*MultipartUploadList, error) {
+	return q.ListMultipartUploadsWithContext(context.Background(), bucketName, region, prefix, marker, maxUploads)
+}
+
+func (q *qiniu) ListMultipartUploadsWithContext(ctx context.Context, bucketName, region, prefix, marker string, maxUploads int) (*MultipartUploadList, error) {
+	keyMarker, uploadIdMarker, err := decodeUploadMarker(marker)
+	if err != nil {
+		return nil, err
+	}
+	if maxUploads <= 0 {
+		maxUploads = defaultMaxUploads
+	}
+	query := url.Values{
+		"uploads":     {""},
+		"max-uploads": {strconv.Itoa(maxUploads)},
+	}
+	if prefix != "" {
+		query.Set("prefix", prefix)
+	}
+	if keyMarker != "" {
+		query.Set("key-marker", keyMarker)
+	}
+	if uploadIdMarker != "" {
+		query.Set("upload-id-marker", uploadIdMarker)
+	}
+	result := &struct {
+		NextKeyMarker      string `xml:"NextKeyMarker"`
+		NextUploadIdMarker string `xml:"NextUploadIdMarker"`
+		IsTruncated        bool   `xml:"IsTruncated"`
+		Uploads            []struct {
+			Key       string    `xml:"Key"`
+			UploadId  string    `xml:"UploadId"`
+			Initiated time.Time `xml:"Initiated"`
+		} `xml:"Upload"`
+	}{}
+	if err = q.callKodoS3(ctx, "GET", region, bucketName, query, result); err != nil {
+		return nil, err
+	}
+	list := &MultipartUploadList{Uploads: make([]MultipartUpload, 0, len(result.Uploads))}
+	for _, upload := range result.Uploads {
+		list.Uploads = append(list.Uploads, MultipartUpload{
+			Key:       upload.Key,
+			UploadId:  upload.UploadId,
+			Initiated: upload.Initiated,
+		})
+	}
+	if result.IsTruncated {
+		list.NextMarker = encodeUploadMarker(result.NextKeyMarker, result.NextUploadIdMarker)
+	}
+	return list, nil
+}
+
+func (q *qiniu) PutObject(bucketName, region, objectKey string, reader io.Reader, size int64, opts *PutObjectOptions) (*CompleteResult, error) {
+	return q.PutObjectWithContext(context.Background(), bucketName, region, objectKey, reader, size, opts)
+}
+
+func (q *qiniu) PutObjectWithContext(ctx context.Context, bucketName, region, objectKey string, reader io.Reader, size int64, opts *PutObjectOptions) (*CompleteResult, error) {
+	cfg, err := q.getKodoConfig(bucketName, region)
+	if err != nil {
+		return nil, err
+	}
+	// 与其他云存储一致，允许覆盖同名文件
+	upToken := q.getUploadToken(bucketName + ":" + objectKey)
+	putExtra := &storage.PutExtra{}
+	if opts != nil {
+		putExtra.MimeType = opts.ContentType
+		if len(opts.Metadata) > 0 {
+			putExtra.Params = make(map[string]string, len(opts.Metadata))
+			for key, value := range opts.Metadata {
+				putExtra.Params["x-qn-meta-"+key] = value
+			}
+		}
+	}
+	result := storage.PutRet{}
+	formUploader := storage.NewFormUploaderEx(cfg, q.getKodoClient())
+	err = formUploader.Put(ctx, &result, upToken, objectKey, io.LimitReader(reader, size), size, putExtra)
+	if err != nil {
+		return nil, err
+	}
+	return &CompleteResult{
+		Bucket: bucketName,
+		Key:    result.Key,
+		ETag:   result.Hash,
+	}, nil
+}
+
+// kodo 通过空间绑定的域名下载文件，没有配置 DownloadDomain 时查询空间绑定的第一个域名，按空间缓存
+func (q *qiniu) getDownloadDomain(bucketName, region string) (string, error) {
+	if q.downloadDomain != "" {
+		return q.downloadDomain, nil
+	}
+	domain, err := q.cache.get(cacheKey("domain", bucketName), func() (interface{}, error) {
+		cfg, err := q.getKodoConfig(bucketName, region)
+		if err != nil {
+			return nil, err
+		}
+		bucketManager := storage.NewBucketManagerEx(qbox.NewMac(q.accessKey, q.secretKey), cfg, q.getKodoClient())
+		domains, err := bucketManager.ListBucketDomains(bucketName)
+		if err != nil {
+			return nil, err
+		}
+		if len(domains) == 0 {
+			return nil, fmt.Errorf("qiniu bucket %s has no domain", bucketName)
+		}
+		return domains[0].Domain, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return domain.(string), nil
+}
+
+// 生成私有下载链接，公开空间同样可以访问，空间绑定的域名不一定支持 https，默认使用 http
+func (q *qiniu) getDownloadURL(bucketName, region, objectKey string, expires time.Duration) (string, error) {
+	domain, err := q.getDownloadDomain(bucketName, region)
+	if err != nil {
+		return "", err
+	}
+	mac := qbox.NewMac(q.accessKey, q.secretKey)
+	deadline := time.Now().Add(expires).Unix()
+	return storage.MakePrivateURL(mac, q.getScheme("http")+"://"+domain, objectKey, deadline), nil
+}
+
+func (q *qiniu) GetObject(bucketName, region, objectKey string, opts *GetObjectOptions) (io.ReadCloser, error) {
+	return q.GetObjectWithContext(context.Background(), bucketName, region, objectKey, opts)
+}
+
+func (q *qiniu) GetObjectWithContext(ctx context.Context, bucketName, region, objectKey string, opts *GetObjectOptions) (io.ReadCloser, error) {
+	downloadURL, err := q.getDownloadURL(bucketName, region, objectKey, time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", downloadURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if byteRange := opts.byteRange(); byteRange != nil {
+		req.Header.Set("Range", byteRange.String())
+	}
+	resp, err := q.getHttpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		return nil, client.ResponseError(resp)
+	}
+	return resp.Body, nil
+}
+
+// kodo 文件不存在的错误码
+const kodoNoSuchFileCode = 612
+
+func (q *qiniu) StatObject(bucketName, region, objectKey string) (*ObjectInfo, error) {
+	return q.StatObjectWithContext(context.Background(), bucketName, region, objectKey)
+}
+
+// BucketManager.Stat 返回的 FileInfo 不包含自定义元数据，这里直接调用 stat 接口
+func (q *qiniu) StatObjectWithContext(ctx context.Context, bucketName, region, objectKey string) (*ObjectInfo, error) {
+	cfg, err := q.getKodoConfig(bucketName, region)
+	if err != nil {
+		return nil, err
+	}
+	mac := qbox.NewMac(q.accessKey, q.secretKey)
+	bucketManager := storage.NewBucketManagerEx(mac, cfg, q.getKodoClient())
+	reqHost, err := bucketManager.RsReqHost(bucketName)
+	if err != nil {
+		return nil, err
+	}
+	result := struct {
+		Hash     string            `json:"hash"`
+		Fsize    int64             `json:"fsize"`
+		PutTime  int64             `json:"putTime"`
+		MimeType string            `json:"mimeType"`
+		MetaData map[string]string `json:"x-qn-meta"`
+	}{}
+	reqUrl := reqHost + storage.URIStat(bucketName, objectKey)
+	err = bucketManager.Client.CredentialedCall(ctx, mac, auth.TokenQiniu, &result, "POST", reqUrl, nil)
+	if err != nil {
+		var errInfo *client.ErrorInfo
+		if errors.As(err, &errInfo) && errInfo.Code == kodoNoSuchFileCode {
+			return nil, wrapNotFound(err)
+		}
+		return nil, err
+	}
+	return &ObjectInfo{
+		Key:         objectKey,
+		Size:        result.Fsize,
+		ETag:        result.Hash,
+		ContentType: result.MimeType,
+		// putTime 的单位是 100 纳秒
+		LastModified: time.Unix(0, result.PutTime*100),
+		Metadata:     normalizeMetadata(result.MetaData),
+	}, nil
+}
+
+func (q *qiniu) DeleteObject(bucketName, region, objectKey string) error {
+	return q.DeleteObjectWithContext(context.Background(), bucketName, region, objectKey)
+}
+
+func (q *qiniu) DeleteObjectWithContext(ctx context.Context, bucketName, region, objectKey string) error {
+	cfg, err := q.getKodoConfig(bucketName, region)
+	if err != nil {
+		return err
+	}
+	mac := qbox.NewMac(q.accessKey, q.secretKey)
+	bucketManager := storage.NewBucketManagerEx(mac, cfg, q.getKodoClient())
+	reqHost, err := bucketManager.RsReqHost(bucketName)
+	if err != nil {
+		return err
+	}
+	reqUrl := reqHost + storage.URIDelete(bucketName, objectKey)
+	err = bucketManager.Client.CredentialedCall(ctx, mac, auth.TokenQiniu, nil, "POST", reqUrl, nil)
+	var errInfo *client.ErrorInfo
+	if errors.As(err, &errInfo) && errInfo.Code == kodoNoSuchFileCode {
+		return nil
+	}
+	return err
+}
+
+func (q *qiniu) DeleteObjects(bucketName, region string, objectKeys []string) ([]DeleteResult, error) {
+	return q.DeleteObjectsWithContext(context.Background(), bucketName, region, objectKeys)
+}
+
+// BucketManager.Batch 不支持 context，这里直接调用 batch 接口
+func (q *qiniu) DeleteObjectsWithContext(ctx context.Context, bucketName, region string, objectKeys []string) ([]DeleteResult, error) {
+	cfg, err := q.getKodoConfig(bucketName, region)
+	if err != nil {
+		return nil, err
+	}
+	mac := qbox.NewMac(q.accessKey, q.secretKey)
+	bucketManager := storage.NewBucketManagerEx(mac, cfg, q.getKodoClient())
+	reqHost, err := bucketManager.RsReqHost(bucketName)
 	if err != nil {
 		return nil, err
 	}
-	return H{
-		"Key": result.Key,
+	failed := make(map[string]error)
+	for _, keys := range chunkKeys(objectKeys, maxDeleteObjects) {
+		operations := make([]string, 0, len(keys))
+		for _, key := range keys {
+			operations = append(operations, storage.URIDelete(bucketName, key))
+		}
+		result := make([]storage.BatchOpRet, 0, len(keys))
+		err = bucketManager.Client.CredentialedCallWithForm(ctx, mac, auth.TokenQiniu, &result, "POST", reqHost+"/batch", nil, map[string][]string{
+			"op": operations,
+		})
+		if err != nil {
+			return nil, err
+		}
+		// 返回结果与请求的操作一一对应
+		for i, ret := range result {
+			if i >= len(keys) || ret.Code/100 == 2 || ret.Code == kodoNoSuchFileCode {
+				continue
+			}
+			failed[keys[i]] = fmt.Errorf("%d: %s", ret.Code, ret.Data.Error)
+		}
+	}
+	return deleteResults(objectKeys, failed), nil
+}
+
+func (q *qiniu) ListObjects(bucketName, region, prefix, delimiter, continuationToken string, maxKeys int) (*ObjectList, error) {
+	return q.ListObjectsWithContext(context.Background(), bucketName, region, prefix, delimiter, continuationToken, maxKeys)
+}
+
+// BucketManager.ListFiles 不支持 context，这里直接调用 list 接口，continuationToken 即为 marker
+func (q *qiniu) ListObjectsWithContext(ctx context.Context, bucketName, region, prefix, delimiter, continuationToken string, maxKeys int) (*ObjectList, error) {
+	cfg, err := q.getKodoConfig(bucketName, region)
+	if err != nil {
+		return nil, err
+	}
+	mac := qbox.NewMac(q.accessKey, q.secretKey)
+	bucketManager := storage.NewBucketManagerEx(mac, cfg, q.getKodoClient())
+	reqHost, err := bucketManager.RsfReqHost(bucketName)
+	if err != nil {
+		return nil, err
+	}
+	if maxKeys <= 0 {
+		maxKeys = defaultMaxKeys
+	}
+	query := url.Values{}
+	query.Set("bucket", bucketName)
+	query.Set("prefix", prefix)
+	query.Set("delimiter", delimiter)
+	query.Set("marker", continuationToken)
+	query.Set("limit", strconv.Itoa(maxKeys))
+	result := struct {
+		Marker         string             `json:"marker"`
+		Items          []storage.ListItem `json:"items"`
+		CommonPrefixes []string           `json:"commonPrefixes"`
+	}{}
+	reqUrl := reqHost + "/list?" + query.Encode()
+	err = bucketManager.Client.CredentialedCall(ctx, mac, auth.TokenQiniu, &result, "POST", reqUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	list := &ObjectList{
+		Objects:               make([]ObjectInfo, 0, len(result.Items)),
+		CommonPrefixes:        result.CommonPrefixes,
+		NextContinuationToken: result.Marker,
+	}
+	for _, item := range result.Items {
+		// 接口可能返回空的记录
+		if item.IsEmpty() {
+			continue
+		}
+		list.Objects = append(list.Objects, ObjectInfo{
+			Key:          item.Key,
+			Size:         item.Fsize,
+			ETag:         item.Hash,
+			ContentType:  item.MimeType,
+			LastModified: time.Unix(0, item.PutTime*100),
+		})
+	}
+	return list, nil
+}
+
+func (q *qiniu) CopyObject(bucketName, region, objectKey, srcBucketName, srcObjectKey string) (*CompleteResult, error) {
+	return q.CopyObjectWithContext(context.Background(), bucketName, region, objectKey, srcBucketName, srcObjectKey)
+}
+
+// kodo 的 copy 接口没有大小限制，不需要分片复制，目标对象存在时会被覆盖
+func (q *qiniu) CopyObjectWithContext(ctx context.Context, bucketName, region, objectKey, srcBucketName, srcObjectKey string) (*CompleteResult, error) {
+	cfg, err := q.getKodoConfig(srcBucketName, region)
+	if err != nil {
+		return nil, err
+	}
+	mac := qbox.NewMac(q.accessKey, q.secretKey)
+	bucketManager := storage.NewBucketManagerEx(mac, cfg, q.getKodoClient())
+	reqHost, err := bucketManager.RsReqHost(srcBucketName)
+	if err != nil {
+		return nil, err
+	}
+	reqUrl := reqHost + storage.URICopy(srcBucketName, srcObjectKey, bucketName, objectKey, true)
+	err = bucketManager.Client.CredentialedCall(ctx, mac, auth.TokenQiniu, nil, "POST", reqUrl, nil)
+	if err != nil {
+		var errInfo *client.ErrorInfo
+		if errors.As(err, &errInfo) && errInfo.Code == kodoNoSuchFileCode {
+			return nil, wrapNotFound(err)
+		}
+		return nil, err
+	}
+	// copy 接口不返回结果，从目标对象获取 hash
+	info, err := q.StatObjectWithContext(ctx, bucketName, region, objectKey)
+	if err != nil {
+		return nil, err
+	}
+	return &CompleteResult{
+		Bucket: bucketName,
+		Key:    objectKey,
+		ETag:   info.ETag,
+	}, nil
+}
+
+// kodo 只支持私有空间的下载凭证，没有配置 DownloadDomain 时需要查询空间绑定的域名
+func (q *qiniu) PresignURL(method, bucketName, region, objectKey string, expiry time.Duration) (string, error) {
+	if _, err := checkPresign(method, expiry, http.MethodGet); err != nil {
+		return "", err
+	}
+	return q.getDownloadURL(bucketName, region, objectKey, expiry)
+}
+
+// kodo 分片上传 v2 使用上传凭证鉴权，凭证放在 Authorization 头中，分片的 etag 在响应的 json 中
+func (q *qiniu) PresignMultipartUploadPart(bucketName, region, objectKey, uploadId string, partNumber uint, expiry time.Duration) (*PresignedPartRequest, error) {
+	if _, err := checkPresign(http.MethodPut, expiry); err != nil {
+		return nil, err
+	}
+	_, upHost, _, err := q.getKodoResumeUploaderV2(bucketName, region)
+	if err != nil {
+		return nil, err
+	}
+	expiration := time.Now().Add(expiry)
+	// 与 MultipartUploadInit 使用相同的 scope
+	putPolicy := storage.PutPolicy{
+		Scope:   bucketName,
+		Expires: uint64(expiry / time.Second),
+	}
+	upToken := putPolicy.UploadToken(qbox.NewMac(q.accessKey, q.secretKey))
+	partURL := upHost + "/buckets/" + bucketName + "/objects/" + encodeV2(objectKey, true) +
+		"/uploads/" + uploadId + "/" + strconv.Itoa(int(partNumber))
+	header := http.Header{}
+	header.Set("Authorization", "UpToken "+upToken)
+	header.Set("Content-Type", "application/octet-stream")
+	return &PresignedPartRequest{
+		PartNumber: partNumber,
+		Method:     http.MethodPut,
+		URL:        partURL,
+		Header:     header,
+		Expiration: expiration,
+	}, nil
+}
+
+// 根据表单上传的限制条件生成完整的上传策略
+func (q *qiniu) getPutPolicy(bucketName string, policy *PostPolicy) storage.PutPolicy {
+	putPolicy := storage.PutPolicy{
+		Scope:            bucketName,
+		Expires:          uint64(policy.Expiry / time.Second),
+		FsizeMin:         policy.MinSize,
+		FsizeLimit:       policy.MaxSize,
+		CallbackURL:      policy.CallbackURL,
+		CallbackBody:     policy.CallbackBody,
+		CallbackBodyType: policy.CallbackBodyType,
+	}
+	if policy.Key != "" {
+		putPolicy.Scope = bucketName + ":" + policy.Key
+	} else if policy.KeyPrefix != "" {
+		putPolicy.Scope = bucketName + ":" + policy.KeyPrefix
+		putPolicy.IsPrefixalScope = 1
+	}
+	if policy.SaveKey != "" {
+		putPolicy.SaveKey = policy.SaveKey
+		putPolicy.ForceSaveKey = true
+	}
+	// mimeLimit 使用 * 匹配前缀
+	if strings.HasSuffix(policy.ContentType, "/") {
+		putPolicy.MimeLimit = policy.ContentType + "*"
+	} else {
+		putPolicy.MimeLimit = policy.ContentType
+	}
+	return putPolicy
+}
+
+// kodo 表单上传使用上传凭证，限制条件都写在上传策略中
+func (q *qiniu) PresignPostPolicy(bucketName, region string, policy *PostPolicy) (*PostPolicyForm, error) {
+	if err := checkPostPolicy(policy); err != nil {
+		return nil, err
+	}
+	_, upHost, _, err := q.getKodoResumeUploaderV2(bucketName, region)
+	if err != nil {
+		return nil, err
+	}
+	expiration := time.Now().Add(policy.Expiry)
+	putPolicy := q.getPutPolicy(bucketName, policy)
+	fields := make(map[string]string)
+	if policy.Key != "" {
+		fields["key"] = policy.Key
+	}
+	fields["token"] = putPolicy.UploadToken(qbox.NewMac(q.accessKey, q.secretKey))
+	return &PostPolicyForm{
+		URL:        upHost,
+		Fields:     fields,
+		Expiration: expiration,
 	}, nil
 }
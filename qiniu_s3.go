@@ -0,0 +1,186 @@
+package go_cover_storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// kodo 原生接口没有提供的功能（如列举分片上传）通过兼容 S3 的接口实现
+// 空间所在区域可以传 kodo 的区域 ID，也可以直接传 S3 的区域名
+var kodoS3Regions = map[string]string{
+	"z0":  "cn-east-1",
+	"z1":  "cn-north-1",
+	"z2":  "cn-south-1",
+	"na0": "us-north-1",
+	"as0": "ap-southeast-1",
+}
+
+var ErrEmptyQiniuRegion = errors.New("qiniu region cannot be empty")
+
+// 兼容 S3 接口的错误响应
+type kodoS3Error struct {
+	StatusCode int    `xml:"-"`
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+	RequestId  string `xml:"RequestId"`
+}
+
+func (e *kodoS3Error) Error() string {
+	return fmt.Sprintf("kodo s3 error: status %d, code %s, message %s, request id %s", e.StatusCode, e.Code, e.Message, e.RequestId)
+}
+
+func kodoS3Region(region string) (string, error) {
+	if region = strings.TrimSpace(region); region == "" {
+		return "", ErrEmptyQiniuRegion
+	}
+	if s3Region, ok := kodoS3Regions[region]; ok {
+		return s3Region, nil
+	}
+	return region, nil
+}
+
+// 按 AWS 签名规范对字符串进行 URI 编码，只保留非保留字符
+func awsURIEncode(value string, encodeSlash bool) string {
+	var builder strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~':
+			builder.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			builder.WriteByte(b)
+		default:
+			builder.WriteString(fmt.Sprintf("%%%02X", b))
+		}
+	}
+	return builder.String()
+}
+
+func awsCanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values := append([]string{}, query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, awsURIEncode(key, true)+"="+awsURIEncode(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// 规范请求，headerNames 为参与签名的请求头，使用小写并按字母排序，返回规范请求和 SignedHeaders
+func awsCanonicalRequest(req *http.Request, headerNames []string, payloadHash string) (string, string) {
+	var canonicalHeaders strings.Builder
+	for _, name := range headerNames {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+			if req.Host != "" {
+				value = req.Host
+			}
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.Join(strings.Fields(value), " ") + "\n")
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+	return strings.Join([]string{
+		req.Method,
+		awsURIEncode(req.URL.Path, false),
+		awsCanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n"), signedHeaders
+}
+
+func awsStringToSign(amzDate, scope, canonicalRequest string) string {
+	return "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+}
+
+func awsSignature(secretKey, date, region, service, stringToSign string) string {
+	signingKey := hmacSHA256([]byte("AWS4"+secretKey), date)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+}
+
+// 使用 AWS Signature V4 签名请求，只支持空请求体
+func (q *qiniu) signKodoS3Request(req *http.Request, s3Region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := sha256Hex(nil)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	canonicalRequest, signedHeaders := awsCanonicalRequest(req, []string{"host", "x-amz-content-sha256", "x-amz-date"}, payloadHash)
+	scope := date + "/" + s3Region + "/s3/aws4_request"
+	signature := awsSignature(q.secretKey, date, s3Region, "s3", awsStringToSign(amzDate, scope, canonicalRequest))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+q.accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// 调用兼容 S3 的接口，响应为 XML 时解析到 ret 中
+func (q *qiniu) callKodoS3(ctx context.Context, method, region, bucketName string, query url.Values, ret interface{}) error {
+	s3Region, err := kodoS3Region(q.getRegion(region))
+	if err != nil {
+		return err
+	}
+	reqUrl := &url.URL{
+		Scheme:   "https",
+		Host:     "s3-" + s3Region + ".qiniucs.com",
+		Path:     "/" + bucketName + "/",
+		RawQuery: awsCanonicalQuery(query),
+	}
+	req, err := http.NewRequest(method, reqUrl.String(), nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	q.signKodoS3Request(req, s3Region, time.Now())
+	resp, err := q.getHttpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		s3Err := &kodoS3Error{StatusCode: resp.StatusCode}
+		_ = xml.Unmarshal(body, s3Err)
+		return s3Err
+	}
+	if ret == nil || len(body) == 0 {
+		return nil
+	}
+	return xml.Unmarshal(body, ret)
+}
@@ -0,0 +1,99 @@
+package go_cover_storage
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// AWS Signature V4 测试套件（aws-sig-v4-test-suite）中的用例，区域 us-east-1，服务 service
+func TestAWSSignatureV4TestSuite(t *testing.T) {
+	tests := []struct {
+		name             string
+		method           string
+		url              string
+		canonicalRequest string
+		stringToSign     string
+		signature        string
+	}{
+		{
+			name:   "get-vanilla",
+			method: "GET",
+			url:    "https://example.amazonaws.com/",
+			canonicalRequest: "GET\n/\n\nhost:example.amazonaws.com\nx-amz-date:20150830T123600Z\n\nhost;x-amz-date\n" +
+				"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			stringToSign: "AWS4-HMAC-SHA256\n20150830T123600Z\n20150830/us-east-1/service/aws4_request\n" +
+				"bb579772317eb040ac9ed261061d46c1f17a8133879d6129b6e1c25292927e63",
+			signature: "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:   "get-vanilla-query-order-key-case",
+			method: "GET",
+			url:    "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			canonicalRequest: "GET\n/\nParam1=value1&Param2=value2\nhost:example.amazonaws.com\nx-amz-date:20150830T123600Z\n\nhost;x-amz-date\n" +
+				"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			stringToSign: "AWS4-HMAC-SHA256\n20150830T123600Z\n20150830/us-east-1/service/aws4_request\n" +
+				"816cd5b414d056048ba4f7c5386d6e0533120fb1fcfa93762cf0fc39e2cf19e0",
+			signature: "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+		{
+			name:   "post-vanilla",
+			method: "POST",
+			url:    "https://example.amazonaws.com/",
+			canonicalRequest: "POST\n/\n\nhost:example.amazonaws.com\nx-amz-date:20150830T123600Z\n\nhost;x-amz-date\n" +
+				"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			stringToSign: "AWS4-HMAC-SHA256\n20150830T123600Z\n20150830/us-east-1/service/aws4_request\n" +
+				"553f88c9e4d10fc9e109e2aeb65f030801b70c2f6468faca261d401ae622fc87",
+			signature: "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(test.method, test.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("X-Amz-Date", "20150830T123600Z")
+			canonicalRequest, signedHeaders := awsCanonicalRequest(req, []string{"host", "x-amz-date"}, sha256Hex(nil))
+			if canonicalRequest != test.canonicalRequest {
+				t.Errorf("canonical request = %q, want %q", canonicalRequest, test.canonicalRequest)
+			}
+			if signedHeaders != "host;x-amz-date" {
+				t.Errorf("signed headers = %s", signedHeaders)
+			}
+			stringToSign := awsStringToSign("20150830T123600Z", "20150830/us-east-1/service/aws4_request", canonicalRequest)
+			if stringToSign != test.stringToSign {
+				t.Errorf("string to sign = %q, want %q", stringToSign, test.stringToSign)
+			}
+			if signature := awsSignature(testSecretKey, "20150830", "us-east-1", "service", stringToSign); signature != test.signature {
+				t.Errorf("signature = %s, want %s", signature, test.signature)
+			}
+		})
+	}
+}
+
+func TestSignKodoS3Request(t *testing.T) {
+	q := &qiniu{accessKey: testAccessKey, secretKey: testSecretKey}
+	req, err := http.NewRequest("GET", "https://s3-cn-east-1.qiniucs.com/bucket/?uploads=&prefix=a%20b&max-uploads=10", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.signKodoS3Request(req, "cn-east-1", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+		t.Errorf("X-Amz-Date = %s", got)
+	}
+	if got := req.Header.Get("X-Amz-Content-Sha256"); got != sha256Hex(nil) {
+		t.Errorf("X-Amz-Content-Sha256 = %s", got)
+	}
+	want := "AWS4-HMAC-SHA256 Credential=" + testAccessKey + "/20150830/cn-east-1/s3/aws4_request, " +
+		"SignedHeaders=host;x-amz-content-sha256;x-amz-date, " +
+		"Signature=b98e39e280a03eb1b52a301b2a51134d52a6d1a2915be73663958f52d45df695"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization = %s, want %s", got, want)
+	}
+	canonicalRequest, _ := awsCanonicalRequest(req, []string{"host", "x-amz-content-sha256", "x-amz-date"}, sha256Hex(nil))
+	if !strings.Contains(canonicalRequest, "\n/bucket/\nmax-uploads=10&prefix=a%20b&uploads=\n") {
+		t.Errorf("canonical request = %q", canonicalRequest)
+	}
+}
@@ -0,0 +1,197 @@
+package go_cover_storage
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 按对象 key 返回内容的假云存储服务，支持 Range，记录收到的请求头
+type fakeObjectServer struct {
+	*httptest.Server
+	content []byte
+
+	mu     sync.Mutex
+	ranges []string
+}
+
+func newFakeObjectServer(content []byte) *fakeObjectServer {
+	s := &fakeObjectServer{content: content}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || !strings.HasSuffix(r.URL.Path, "/"+testObjectKey) {
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		s.mu.Lock()
+		s.ranges = append(s.ranges, r.Header.Get("Range"))
+		s.mu.Unlock()
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(s.content))
+	}))
+	return s
+}
+
+func (s *fakeObjectServer) lastRange() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.ranges) == 0 {
+		return ""
+	}
+	return s.ranges[len(s.ranges)-1]
+}
+
+// 所有连接都发到假服务，用于必须使用空间域名的云存储
+func (s *fakeObjectServer) transport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, s.Listener.Addr().String())
+	}
+	return transport
+}
+
+func testContent(size int) []byte {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte('a' + i%26)
+	}
+	return content
+}
+
+func TestGetObjectRange(t *testing.T) {
+	content := testContent(64)
+	server := newFakeObjectServer(content)
+	defer server.Close()
+	host := server.Listener.Addr().String()
+	cloud := CloudConfig{AccessKey: testAccessKey, SecretKey: testSecretKey, Endpoint: host, Scheme: "http", Region: "z0"}
+
+	tencentConfig := TencentConfig{CloudConfig: cloud, AppId: "1250000000"}
+	tencentConfig.Endpoint = "cos.example.com"
+	tencentClient := tencentConfig.newClient().(*tencent)
+	_, _ = tencentClient.cache.get("transport", func() (interface{}, error) {
+		return server.transport(), nil
+	})
+	qiniuConfig := QiniuConfig{CloudConfig: cloud, DownloadDomain: host}
+	qiniuConfig.Endpoint = ""
+
+	dir, err := ioutil.TempDir("", "range")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	localConfig := LocalConfig{TempDir: filepath.Join(dir, "temp"), StorageDir: filepath.Join(dir, "storage")}
+	localClient := localConfig.newClient()
+	if _, err = localClient.PutObject("bucket", "", testObjectKey, bytes.NewReader(content), int64(len(content)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	clients := map[string]StoreClient{
+		"aliyun":  AliyunConfig{cloud}.newClient(),
+		"baidu":   BaiduConfig{cloud}.newClient(),
+		"huawei":  HuaweiConfig{cloud}.newClient(),
+		"tencent": tencentClient,
+		"qiniu":   qiniuConfig.newClient(),
+		"local":   localClient,
+	}
+	last := int64(len(content) - 1)
+	ranges := []*ByteRange{
+		nil,
+		{Start: 0, End: 0},
+		{Start: 5, End: 5},
+		{Start: last, End: last},
+		{Start: 2, End: 9},
+		{Start: 10, End: -1},
+		{Start: 60, End: 100},
+	}
+	for provider, client := range clients {
+		t.Run(provider, func(t *testing.T) {
+			defer client.Close()
+			for _, byteRange := range ranges {
+				want := content
+				if byteRange != nil {
+					end := byteRange.End + 1
+					if byteRange.End < 0 || end > int64(len(content)) {
+						end = int64(len(content))
+					}
+					want = content[byteRange.Start:end]
+				}
+				body, err := client.GetObject("bucket", "", testObjectKey, &GetObjectOptions{Range: byteRange})
+				if err != nil {
+					t.Fatalf("range %v: %v", byteRange, err)
+				}
+				data, err := ioutil.ReadAll(body)
+				_ = body.Close()
+				if err != nil {
+					t.Fatalf("range %v: %v", byteRange, err)
+				}
+				if !bytes.Equal(data, want) {
+					t.Errorf("range %v = %q, want %q (Range header %q)", byteRange, data, want, server.lastRange())
+				}
+				if provider != "local" && byteRange != nil && server.lastRange() == "" {
+					t.Errorf("range %v sent without Range header", byteRange)
+				}
+			}
+		})
+	}
+}
+
+// Timeout 是包括读取响应的单次请求超时，服务端发送部分响应后停止时读取返回错误
+func TestGetObjectTimeout(t *testing.T) {
+	stop := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		w.Header().Set("ETag", `"etag"`)
+		_, _ = w.Write(testContent(10))
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-stop:
+		}
+	}))
+	defer server.Close()
+	defer close(stop)
+	host := server.Listener.Addr().String()
+	cloud := CloudConfig{AccessKey: testAccessKey, SecretKey: testSecretKey, Endpoint: host, Scheme: "http", Region: "z0", Timeout: 300 * time.Millisecond}
+	fake := &fakeObjectServer{Server: server}
+
+	tencentConfig := TencentConfig{CloudConfig: cloud, AppId: "1250000000"}
+	tencentConfig.Endpoint = "cos.example.com"
+	tencentClient := tencentConfig.newClient().(*tencent)
+	_, _ = tencentClient.cache.get("transport", func() (interface{}, error) {
+		return fake.transport(), nil
+	})
+	qiniuConfig := QiniuConfig{CloudConfig: cloud, DownloadDomain: host}
+	qiniuConfig.Endpoint = ""
+	clients := map[string]StoreClient{
+		"aliyun":  AliyunConfig{cloud}.newClient(),
+		"baidu":   BaiduConfig{cloud}.newClient(),
+		"huawei":  HuaweiConfig{cloud}.newClient(),
+		"tencent": tencentClient,
+		"qiniu":   qiniuConfig.newClient(),
+	}
+	for provider, client := range clients {
+		t.Run(provider, func(t *testing.T) {
+			defer client.Close()
+			start := time.Now()
+			body, err := client.GetObject("bucket", "", testObjectKey, nil)
+			if err == nil {
+				_, err = ioutil.ReadAll(body)
+				_ = body.Close()
+			}
+			if err == nil {
+				t.Error("stalled response should time out")
+			}
+			// bce 的超时按整秒计算
+			if elapsed := time.Since(start); elapsed > 3*time.Second {
+				t.Errorf("timed out after %v", elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package go_cover_storage
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+)
+
+// 清理过期分片上传
+// 列举各个空间中进行中的分片上传，初始化时间早于 TTL 的会被取消，释放已上传分片占用的存储
+type Reaper struct {
+	Client StoreClient
+	// 分片上传的存活时间，超过后会被取消，必须大于 0，避免取消进行中的上传
+	TTL time.Duration
+	// 只列出需要清理的分片上传，不实际取消
+	DryRun bool
+	// 空间名匹配规则，使用 path.Match 语法，Include 为空表示所有空间
+	Include []string
+	Exclude []string
+	// 当前时间，默认为 time.Now
+	Now func() time.Time
+}
+
+// 需要清理的空间
+type ReapTarget struct {
+	Bucket string
+	Region string
+	Prefix string
+}
+
+// 单个分片上传的清理结果
+type ReapResult struct {
+	Bucket    string
+	Region    string
+	Key       string
+	UploadId  string
+	Initiated time.Time
+	// DryRun 时为 false
+	Aborted bool
+	Err     error
+}
+
+var (
+	ErrEmptyReaperClient = errors.New("reaper client cannot be empty")
+	ErrInvalidReaperTTL  = errors.New("reaper ttl must be positive")
+)
+
+func NewReaper(client StoreClient, ttl time.Duration) *Reaper {
+	return &Reaper{
+		Client: client,
+		TTL:    ttl,
+	}
+}
+
+func (r *Reaper) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
+	}
+	return time.Now()
+}
+
+// 空间是否需要清理
+func (r *Reaper) matchBucket(bucketName string) bool {
+	for _, pattern := range r.Exclude {
+		if ok, _ := path.Match(pattern, bucketName); ok {
+			return false
+		}
+	}
+	if len(r.Include) == 0 {
+		return true
+	}
+	for _, pattern := range r.Include {
+		if ok, _ := path.Match(pattern, bucketName); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Reaper) check() error {
+	if r.Client == nil {
+		return ErrEmptyReaperClient
+	}
+	if r.TTL <= 0 {
+		return ErrInvalidReaperTTL
+	}
+	return nil
+}
+
+// 清理各个空间中过期的分片上传，取消失败记录在对应结果的 Err 中，列举失败时直接返回
+func (r *Reaper) Reap(ctx context.Context, targets ...ReapTarget) ([]ReapResult, error) {
+	if err := r.check(); err != nil {
+		return nil, err
+	}
+	deadline := r.now().Add(-r.TTL)
+	results := make([]ReapResult, 0)
+	for _, target := range targets {
+		if !r.matchBucket(target.Bucket) {
+			continue
+		}
+		marker := ""
+		for {
+			list, err := r.Client.ListMultipartUploadsWithContext(ctx, target.Bucket, target.Region, target.Prefix, marker, 0)
+			if err != nil {
+				return results, err
+			}
+			for _, upload := range list.Uploads {
+				// 无法确定初始化时间的分片上传不做处理
+				if upload.Initiated.IsZero() || !upload.Initiated.Before(deadline) {
+					continue
+				}
+				result := ReapResult{
+					Bucket:    target.Bucket,
+					Region:    target.Region,
+					Key:       upload.Key,
+					UploadId:  upload.UploadId,
+					Initiated: upload.Initiated,
+				}
+				if !r.DryRun {
+					result.Err = r.Client.MultipartUploadAbortWithContext(ctx, target.Bucket, target.Region, upload.Key, upload.UploadId)
+					result.Aborted = result.Err == nil
+				}
+				results = append(results, result)
+			}
+			if list.NextMarker == "" {
+				break
+			}
+			marker = list.NextMarker
+		}
+	}
+	return results, nil
+}
+
+// 按修改时间清理本地存储 tempDir 下过期的分片目录，返回清理的目录
+// 包括没有元数据、无法通过 ListMultipartUploads 列出的旧目录，其他存储直接返回
+func (r *Reaper) ReapLocalTempDirs(ctx context.Context) ([]string, error) {
+	if err := r.check(); err != nil {
+		return nil, err
+	}
+	l, ok := unwrapStoreClient(r.Client).(*local)
+	if !ok {
+		return nil, nil
+	}
+	tempDir := l.tempDir
+	dirs, err := ioutil.ReadDir(tempDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	deadline := r.now().Add(-r.TTL)
+	removed := make([]string, 0)
+	for _, dir := range dirs {
+		if err = ctx.Err(); err != nil {
+			return removed, err
+		}
+		if !dir.IsDir() {
+			continue
+		}
+		partDir := path.Join(tempDir, dir.Name())
+		if meta, err := readLocalUploadMeta(partDir); err == nil && !r.matchBucket(meta.Bucket) {
+			continue
+		}
+		modTime, err := latestModTime(partDir, dir)
+		if err != nil {
+			return removed, err
+		}
+		if !modTime.Before(deadline) {
+			continue
+		}
+		if !r.DryRun {
+			if err = os.RemoveAll(partDir); err != nil {
+				return removed, err
+			}
+		}
+		removed = append(removed, partDir)
+	}
+	return removed, nil
+}
+
+// 目录及其中文件最近的修改时间，重传分片只会修改文件时间
+func latestModTime(dir string, info os.FileInfo) (time.Time, error) {
+	modTime := info.ModTime()
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return modTime, err
+	}
+	for _, file := range files {
+		if file.ModTime().After(modTime) {
+			modTime = file.ModTime()
+		}
+	}
+	return modTime, nil
+}
@@ -0,0 +1,105 @@
+package go_cover_storage
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestLocalClient(t *testing.T) (StoreClient, func()) {
+	dir, err := ioutil.TempDir("", "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClient(LocalConfig{TempDir: filepath.Join(dir, "temp"), StorageDir: filepath.Join(dir, "storage")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, func() {
+		_ = client.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestReaperRejectsNonPositiveTTL(t *testing.T) {
+	client, cleanup := newTestLocalClient(t)
+	defer cleanup()
+	uploadId, err := client.MultipartUploadInit("bucket", "", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ttl := range []time.Duration{0, -time.Hour} {
+		reaper := NewReaper(client, ttl)
+		if _, err = reaper.Reap(context.Background(), ReapTarget{Bucket: "bucket"}); !errors.Is(err, ErrInvalidReaperTTL) {
+			t.Errorf("Reap with ttl %v = %v", ttl, err)
+		}
+		if _, err = reaper.ReapLocalTempDirs(context.Background()); !errors.Is(err, ErrInvalidReaperTTL) {
+			t.Errorf("ReapLocalTempDirs with ttl %v = %v", ttl, err)
+		}
+	}
+	if list, err := client.ListMultipartUploads("bucket", "", "", "", 0); err != nil || len(list.Uploads) != 1 || list.Uploads[0].UploadId != uploadId {
+		t.Errorf("live upload was removed: %+v, %v", list, err)
+	}
+	if _, err = (&Reaper{TTL: time.Hour}).Reap(context.Background()); !errors.Is(err, ErrEmptyReaperClient) {
+		t.Errorf("Reap without client = %v", err)
+	}
+}
+
+func TestReaperReap(t *testing.T) {
+	client, cleanup := newTestLocalClient(t)
+	defer cleanup()
+	uploadId, err := client.MultipartUploadInit("bucket", "", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := ReapTarget{Bucket: "bucket"}
+	reaper := NewReaper(client, time.Hour)
+	results, err := reaper.Reap(context.Background(), target)
+	if err != nil || len(results) != 0 {
+		t.Fatalf("fresh upload reaped: %v, %v", results, err)
+	}
+
+	reaper.Now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	reaper.DryRun = true
+	results, err = reaper.Reap(context.Background(), target)
+	if err != nil || len(results) != 1 || results[0].UploadId != uploadId || results[0].Aborted {
+		t.Fatalf("dry run = %+v, %v", results, err)
+	}
+	reaper.DryRun = false
+	reaper.Exclude = []string{"buck*"}
+	if results, err = reaper.Reap(context.Background(), target); err != nil || len(results) != 0 {
+		t.Fatalf("excluded bucket reaped: %+v, %v", results, err)
+	}
+	reaper.Exclude = nil
+	results, err = reaper.Reap(context.Background(), target)
+	if err != nil || len(results) != 1 || !results[0].Aborted {
+		t.Fatalf("reap = %+v, %v", results, err)
+	}
+	if list, err := client.ListMultipartUploads("bucket", "", "", "", 0); err != nil || len(list.Uploads) != 0 {
+		t.Errorf("upload still exists: %+v, %v", list, err)
+	}
+}
+
+func TestReaperReapLocalTempDirs(t *testing.T) {
+	client, cleanup := newTestLocalClient(t)
+	defer cleanup()
+	if _, err := client.MultipartUploadInit("bucket", "", "key"); err != nil {
+		t.Fatal(err)
+	}
+	reaper := NewReaper(client, time.Hour)
+	if removed, err := reaper.ReapLocalTempDirs(context.Background()); err != nil || len(removed) != 0 {
+		t.Fatalf("fresh dir removed: %v, %v", removed, err)
+	}
+	reaper.Now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	removed, err := reaper.ReapLocalTempDirs(context.Background())
+	if err != nil || len(removed) != 1 {
+		t.Fatalf("removed = %v, %v", removed, err)
+	}
+	if _, err = os.Stat(removed[0]); !os.IsNotExist(err) {
+		t.Errorf("%s still exists", removed[0])
+	}
+}
@@ -0,0 +1,72 @@
+package go_cover_storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 根据 CreateClient 的 options 创建客户端
+type ProviderFactory func(options map[string]interface{}) (StoreClient, error)
+
+var (
+	ErrEmptyProviderName    = errors.New("provider name cannot be empty")
+	ErrEmptyProviderFactory = errors.New("provider factory cannot be empty")
+	ErrProviderExists       = errors.New("provider already registered")
+)
+
+var (
+	providersMu sync.RWMutex
+	providers   = make(map[string]ProviderFactory)
+)
+
+// 注册和查找时名称都去掉首尾空白
+func normalizeProviderName(name string) string {
+	return strings.TrimSpace(name)
+}
+
+// 注册云存储，注册后可以通过 CreateClient 按名称创建客户端，重复注册同一名称返回 ErrProviderExists
+func RegisterProvider(name string, factory ProviderFactory) error {
+	if name = normalizeProviderName(name); name == "" {
+		return ErrEmptyProviderName
+	}
+	if factory == nil {
+		return ErrEmptyProviderFactory
+	}
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	if _, ok := providers[name]; ok {
+		return fmt.Errorf("%w: %s", ErrProviderExists, name)
+	}
+	providers[name] = factory
+	return nil
+}
+
+// 内置云存储在 init 中注册，失败说明名称冲突
+func mustRegisterProvider(name string, factory ProviderFactory) {
+	if err := RegisterProvider(name, factory); err != nil {
+		panic(err)
+	}
+}
+
+// 查找已注册的云存储
+func LookupProvider(name string) (ProviderFactory, bool) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	factory, ok := providers[normalizeProviderName(name)]
+	return factory, ok
+}
+
+// 已注册的云存储名称，按字母排序
+func Providers() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,61 @@
+package go_cover_storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRegisterProvider(t *testing.T) {
+	factory := func(options map[string]interface{}) (StoreClient, error) {
+		return nil, errors.New("test provider")
+	}
+	if err := RegisterProvider(" registry-test ", factory); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		providersMu.Lock()
+		delete(providers, "registry-test")
+		providersMu.Unlock()
+	}()
+	for _, name := range []string{"registry-test", " registry-test", "registry-test\t"} {
+		if _, ok := LookupProvider(name); !ok {
+			t.Errorf("LookupProvider(%q) not found", name)
+		}
+	}
+	for _, name := range []string{"registry-test", "registry-test "} {
+		if err := RegisterProvider(name, factory); !errors.Is(err, ErrProviderExists) {
+			t.Errorf("RegisterProvider(%q) = %v, want ErrProviderExists", name, err)
+		}
+	}
+	if err := RegisterProvider("aliyun", factory); !errors.Is(err, ErrProviderExists) {
+		t.Errorf("RegisterProvider(aliyun) = %v, want ErrProviderExists", err)
+	}
+	if err := RegisterProvider("  ", factory); !errors.Is(err, ErrEmptyProviderName) {
+		t.Errorf("empty name = %v", err)
+	}
+	if err := RegisterProvider("registry-nil", nil); !errors.Is(err, ErrEmptyProviderFactory) {
+		t.Errorf("nil factory = %v", err)
+	}
+	if _, err := CreateClient(" registry-test ", nil); err == nil || err.Error() != "test provider" {
+		t.Errorf("CreateClient = %v", err)
+	}
+}
+
+func TestLookupUnknownProvider(t *testing.T) {
+	if _, ok := LookupProvider("unknown"); ok {
+		t.Error("unknown provider found")
+	}
+	if _, err := CreateClient("unknown", nil); err == nil {
+		t.Error("CreateClient with unknown provider should fail")
+	}
+	want := []string{"aliyun", "baidu", "huawei", "local", "qiniu", "tencent"}
+	names := Providers()
+	if len(names) != len(want) {
+		t.Fatalf("Providers() = %v", names)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("Providers() = %v", names)
+		}
+	}
+}
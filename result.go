@@ -0,0 +1,123 @@
+package go_cover_storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"hash"
+	"io"
+)
+
+// 上传时同时计算数据的 md5，用于填写分片结果的 Checksum
+type checksumReader struct {
+	reader io.Reader
+	hash   hash.Hash
+}
+
+func newChecksumReader(reader io.Reader) *checksumReader {
+	return &checksumReader{
+		reader: reader,
+		hash:   md5.New(),
+	}
+}
+
+func (r *checksumReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.hash.Write(p[:n])
+	return n, err
+}
+
+func (r *checksumReader) Checksum() string {
+	return base64.StdEncoding.EncodeToString(r.hash.Sum(nil))
+}
+
+// 转换为旧版本返回的 H
+func (r *UploadPartResult) H() H {
+	return H{
+		"PartNumber": int(r.PartNumber),
+		"ETag":       r.ETag,
+		"Size":       r.Size,
+		"Checksum":   r.Checksum,
+	}
+}
+
+// 转换为旧版本返回的 H，本地存储旧版本返回的文件路径保留在 path 中
+func (r *CompleteResult) H() H {
+	return H{
+		"Bucket":    r.Bucket,
+		"Key":       r.Key,
+		"ETag":      r.ETag,
+		"Location":  r.Location,
+		"VersionID": r.VersionID,
+		"path":      r.Location,
+	}
+}
+
+// 兼容返回 H 的旧接口，其他方法与 StoreClient 相同
+type HClient struct {
+	StoreClient
+}
+
+func NewHClient(client StoreClient) *HClient {
+	return &HClient{StoreClient: client}
+}
+
+func (c *HClient) MultipartUploadPart(bucketName, region, objectKey, uploadId string, partNumber uint, body []byte) (H, error) {
+	return c.MultipartUploadPartWithContext(context.Background(), bucketName, region, objectKey, uploadId, partNumber, body)
+}
+
+func (c *HClient) MultipartUploadPartWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string, partNumber uint, body []byte) (H, error) {
+	result, err := c.StoreClient.MultipartUploadPartWithContext(ctx, bucketName, region, objectKey, uploadId, partNumber, body)
+	if err != nil {
+		return nil, err
+	}
+	return result.H(), nil
+}
+
+func (c *HClient) MultipartUploadPartFromReader(bucketName, region, objectKey, uploadId string, partNumber uint, reader io.Reader, size int64) (H, error) {
+	return c.MultipartUploadPartFromReaderWithContext(context.Background(), bucketName, region, objectKey, uploadId, partNumber, reader, size)
+}
+
+func (c *HClient) MultipartUploadPartFromReaderWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string, partNumber uint, reader io.Reader, size int64) (H, error) {
+	result, err := c.StoreClient.MultipartUploadPartFromReaderWithContext(ctx, bucketName, region, objectKey, uploadId, partNumber, reader, size)
+	if err != nil {
+		return nil, err
+	}
+	return result.H(), nil
+}
+
+func (c *HClient) MultipartUploadComplete(bucketName, region, objectKey, uploadId string, parts map[uint]string) (H, error) {
+	return c.MultipartUploadCompleteWithContext(context.Background(), bucketName, region, objectKey, uploadId, parts)
+}
+
+func (c *HClient) MultipartUploadCompleteWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string, parts map[uint]string) (H, error) {
+	result, err := c.StoreClient.MultipartUploadCompleteWithContext(ctx, bucketName, region, objectKey, uploadId, parts)
+	if err != nil {
+		return nil, err
+	}
+	return result.H(), nil
+}
+
+func (c *HClient) PutObject(bucketName, region, objectKey string, reader io.Reader, size int64, opts *PutObjectOptions) (H, error) {
+	return c.PutObjectWithContext(context.Background(), bucketName, region, objectKey, reader, size, opts)
+}
+
+func (c *HClient) PutObjectWithContext(ctx context.Context, bucketName, region, objectKey string, reader io.Reader, size int64, opts *PutObjectOptions) (H, error) {
+	result, err := c.StoreClient.PutObjectWithContext(ctx, bucketName, region, objectKey, reader, size, opts)
+	if err != nil {
+		return nil, err
+	}
+	return result.H(), nil
+}
+
+func (c *HClient) CopyObject(bucketName, region, objectKey, srcBucketName, srcObjectKey string) (H, error) {
+	return c.CopyObjectWithContext(context.Background(), bucketName, region, objectKey, srcBucketName, srcObjectKey)
+}
+
+func (c *HClient) CopyObjectWithContext(ctx context.Context, bucketName, region, objectKey, srcBucketName, srcObjectKey string) (H, error) {
+	result, err := c.StoreClient.CopyObjectWithContext(ctx, bucketName, region, objectKey, srcBucketName, srcObjectKey)
+	if err != nil {
+		return nil, err
+	}
+	return result.H(), nil
+}
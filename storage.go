@@ -1,9 +1,17 @@
 package go_cover_storage
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
 	"strings"
+	"time"
 )
 
 type H map[string]interface{}
@@ -13,15 +21,218 @@ type ClientInterface interface {
 }
 
 // 云存储客户端
+// 需要请求云存储的方法都有对应的 WithContext 版本，ctx 取消或超时后会中断正在进行的请求
+// 客户端创建后不再修改，可以在多个 goroutine 中并发使用
 type StoreClient interface {
 	// 初始化分片上传
 	MultipartUploadInit(bucketName, region, objectKey string) (string, error)
+	MultipartUploadInitWithContext(ctx context.Context, bucketName, region, objectKey string) (string, error)
 	// 上传分片
-	MultipartUploadPart(bucketName, region, objectKey, uploadId string, partNumber uint, body []byte) (H, error)
+	MultipartUploadPart(bucketName, region, objectKey, uploadId string, partNumber uint, body []byte) (*UploadPartResult, error)
+	MultipartUploadPartWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string, partNumber uint, body []byte) (*UploadPartResult, error)
+	// 流式上传分片，从 reader 中读取 size 字节直接上传，不会整块读入内存
+	MultipartUploadPartFromReader(bucketName, region, objectKey, uploadId string, partNumber uint, reader io.Reader, size int64) (*UploadPartResult, error)
+	MultipartUploadPartFromReaderWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string, partNumber uint, reader io.Reader, size int64) (*UploadPartResult, error)
 	// 完成分片上传
-	MultipartUploadComplete(bucketName, region, objectKey, uploadId string, parts map[uint]string) (H, error)
+	MultipartUploadComplete(bucketName, region, objectKey, uploadId string, parts map[uint]string) (*CompleteResult, error)
+	MultipartUploadCompleteWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string, parts map[uint]string) (*CompleteResult, error)
+	// 取消分片上传，删除已上传的分片
+	MultipartUploadAbort(bucketName, region, objectKey, uploadId string) error
+	MultipartUploadAbortWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string) error
+	// 列举已上传的分片，用于断点续传
+	MultipartUploadListParts(bucketName, region, objectKey, uploadId string) ([]Part, error)
+	MultipartUploadListPartsWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string) ([]Part, error)
+	// 分页列举进行中的分片上传，marker 为上一页返回的 NextMarker，maxUploads 小于等于 0 时使用默认值
+	ListMultipartUploads(bucketName, region, prefix, marker string, maxUploads int) (*MultipartUploadList, error)
+	ListMultipartUploadsWithContext(ctx context.Context, bucketName, region, prefix, marker string, maxUploads int) (*MultipartUploadList, error)
+	// 简单上传，适合小文件，一次请求完成上传，opts 可以为 nil
+	PutObject(bucketName, region, objectKey string, reader io.Reader, size int64, opts *PutObjectOptions) (*CompleteResult, error)
+	PutObjectWithContext(ctx context.Context, bucketName, region, objectKey string, reader io.Reader, size int64, opts *PutObjectOptions) (*CompleteResult, error)
+	// 读取对象，调用方需要关闭返回的 io.ReadCloser，opts 可以为 nil
+	GetObject(bucketName, region, objectKey string, opts *GetObjectOptions) (io.ReadCloser, error)
+	GetObjectWithContext(ctx context.Context, bucketName, region, objectKey string, opts *GetObjectOptions) (io.ReadCloser, error)
+	// 查询对象元数据，不下载内容，对象不存在时返回 ErrObjectNotFound
+	StatObject(bucketName, region, objectKey string) (*ObjectInfo, error)
+	StatObjectWithContext(ctx context.Context, bucketName, region, objectKey string) (*ObjectInfo, error)
+	// 分页列举对象，delimiter 不为空时按其把下一级分组为 CommonPrefixes
+	// continuationToken 为上一页返回的 NextContinuationToken，maxKeys 小于等于 0 时使用默认值
+	ListObjects(bucketName, region, prefix, delimiter, continuationToken string, maxKeys int) (*ObjectList, error)
+	ListObjectsWithContext(ctx context.Context, bucketName, region, prefix, delimiter, continuationToken string, maxKeys int) (*ObjectList, error)
+	// 服务端复制同一地域的 srcBucketName/srcObjectKey 到 bucketName/objectKey，超过单次复制上限的对象自动使用分片复制
+	CopyObject(bucketName, region, objectKey, srcBucketName, srcObjectKey string) (*CompleteResult, error)
+	CopyObjectWithContext(ctx context.Context, bucketName, region, objectKey, srcBucketName, srcObjectKey string) (*CompleteResult, error)
+	// 生成预签名 URL，使用客户端的密钥在本地签名，method 支持 GET、PUT、HEAD、DELETE
+	PresignURL(method, bucketName, region, objectKey string, expiry time.Duration) (string, error)
+	// 生成浏览器直传分片的请求，浏览器按返回的 Method、Header 把分片数据发送到 URL，服务端再用分片的 ETag 完成分片上传
+	PresignMultipartUploadPart(bucketName, region, objectKey, uploadId string, partNumber uint, expiry time.Duration) (*PresignedPartRequest, error)
+	// 生成浏览器表单上传需要的地址和表单字段
+	PresignPostPolicy(bucketName, region string, policy *PostPolicy) (*PostPolicyForm, error)
+	// 删除对象，对象不存在时不返回错误
+	DeleteObject(bucketName, region, objectKey string) error
+	DeleteObjectWithContext(ctx context.Context, bucketName, region, objectKey string) error
+	// 批量删除对象，按 objectKeys 的顺序返回每个对象的删除结果，请求失败时返回 error
+	DeleteObjects(bucketName, region string, objectKeys []string) ([]DeleteResult, error)
+	DeleteObjectsWithContext(ctx context.Context, bucketName, region string, objectKeys []string) ([]DeleteResult, error)
+	// 释放缓存的 SDK 客户端和空闲连接，之后仍然可以调用其他方法，会重新创建
+	Close() error
 }
 
+// 简单上传的可选参数
+type PutObjectOptions struct {
+	ContentType string
+	// 用户自定义元数据，不需要带各云存储的前缀
+	Metadata map[string]string
+}
+
+// 已上传的分片
+type Part struct {
+	PartNumber   int
+	ETag         string
+	Size         int64
+	LastModified time.Time
+}
+
+// 进行中的分片上传
+type MultipartUpload struct {
+	Key       string
+	UploadId  string
+	Initiated time.Time
+}
+
+// 分片上传列表的一页，NextMarker 为空表示已经列举完
+type MultipartUploadList struct {
+	Uploads    []MultipartUpload
+	NextMarker string
+}
+
+// 上传分片的结果
+type UploadPartResult struct {
+	PartNumber uint
+	ETag       string
+	Size       int64
+	// 分片数据的 md5，base64 编码，与 Content-MD5 请求头的格式相同
+	Checksum string
+}
+
+// 完成上传、简单上传和复制对象的结果，云存储没有返回的字段为空
+type CompleteResult struct {
+	Bucket string
+	Key    string
+	ETag   string
+	// 对象的访问地址，本地存储为文件路径
+	Location  string
+	VersionID string
+}
+
+// 对象元数据
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ETag         string
+	ContentType  string
+	LastModified time.Time
+	// 用户自定义元数据，key 不带各云存储的前缀并统一为小写
+	Metadata map[string]string
+}
+
+// 一页对象列表
+type ObjectList struct {
+	// 列举结果不包含 ContentType 和 Metadata
+	Objects []ObjectInfo
+	// 按 delimiter 分组的公共前缀，相当于子目录
+	CommonPrefixes []string
+	// 下一页的分页标记，为空表示已经列举完
+	NextContinuationToken string
+}
+
+const defaultMaxKeys = 1000
+
+const (
+	// oss、cos、obs、bos 单次复制的对象最大 5GB
+	maxCopyObjectSize = 5 << 30
+	// 分片复制默认的分片大小，分片数超过上限时翻倍
+	copyPartSize = 512 << 20
+)
+
+// 复制源对象 [start, end] 范围的数据作为一个分片，返回分片的 ETag
+type copyPartFunc func(uploadId string, partNumber int, start, end int64) (string, error)
+
+// 预签名的分片上传请求
+type PresignedPartRequest struct {
+	PartNumber uint
+	Method     string
+	URL        string
+	// 浏览器需要附带的请求头，oss、cos、obs、bos 的签名都在 URL 中，七牛需要 Authorization 头
+	Header http.Header
+	// 过期时间
+	Expiration time.Time
+}
+
+// 表单上传的限制条件
+type PostPolicy struct {
+	// 有效期
+	Expiry time.Duration
+	// 对象 key，为空时浏览器提交的 key 需要以 KeyPrefix 开头
+	Key       string
+	KeyPrefix string
+	// 文件大小范围，MaxSize 为 0 表示不限制
+	MinSize int64
+	MaxSize int64
+	// 文件类型，以 / 结尾时按前缀匹配，例如 image/
+	ContentType string
+	// 以下只对七牛生效，SaveKey 为服务端生成 key 的模板，例如 $(etag)$(ext)
+	SaveKey          string
+	CallbackURL      string
+	CallbackBody     string
+	CallbackBodyType string
+}
+
+// 表单上传的地址和字段，浏览器提交时文件字段 file 需要放在最后
+type PostPolicyForm struct {
+	URL        string
+	Fields     map[string]string
+	Expiration time.Time
+}
+
+// 批量删除中单个对象的结果，Err 为 nil 表示删除成功
+type DeleteResult struct {
+	Key string
+	Err error
+}
+
+// 各云存储批量删除单次最多 1000 个对象
+const maxDeleteObjects = 1000
+
+// 读取对象的可选参数
+type GetObjectOptions struct {
+	// 读取的字节范围，为 nil 时读取整个对象
+	Range *ByteRange
+}
+
+// 字节范围 [Start, End]，End 小于 0 表示读到对象末尾
+type ByteRange struct {
+	Start int64
+	End   int64
+}
+
+// HTTP Range 请求头
+func (r *ByteRange) String() string {
+	if r.End < 0 {
+		return fmt.Sprintf("bytes=%d-", r.Start)
+	}
+	return fmt.Sprintf("bytes=%d-%d", r.Start, r.End)
+}
+
+func (o *GetObjectOptions) byteRange() *ByteRange {
+	if o == nil {
+		return nil
+	}
+	return o.Range
+}
+
+// 默认每页列举的分片上传数量
+const defaultMaxUploads = 1000
+
 var (
 	Aliyun  ClientInterface
 	Baidu   ClientInterface
@@ -38,37 +249,32 @@ var (
 	ErrStringAccessKey = errors.New("accessKey is not a string")
 	ErrStringSecretKey = errors.New("secretKey is not a string")
 	ErrStringAppId     = errors.New("appId is not a string")
-)
+	ErrObjectNotFound  = errors.New("object not found")
 
-func init() {
-	Aliyun = &aliyun{}
-	Baidu = &baidu{}
-	Huawei = &huawei{}
-	Local = &local{}
-	Qiniu = &qiniu{}
-	Tencent = &tencent{}
-}
+	ErrUnsupportedPresignMethod = errors.New("presign method is not supported")
+	ErrInvalidPresignExpiry     = errors.New("presign expiry must be positive")
+	ErrEmptyPostPolicy          = errors.New("post policy cannot be empty")
+	ErrInvalidPostPolicySize    = errors.New("post policy MinSize cannot be greater than MaxSize")
+)
 
+// 使用 RegisterProvider 注册的云存储创建客户端
 func CreateClient(clientName string, options map[string]interface{}) (StoreClient, error) {
-	var client ClientInterface
-	switch clientName {
-	case "aliyun":
-		client = Aliyun
-	case "baidu":
-		client = Baidu
-	case "huawei":
-		client = Huawei
-	case "local":
-		client = Local
-	case "qiniu":
-		client = Qiniu
-	case "tencent":
-		client = Tencent
-	}
-	if client == nil {
+	factory, ok := LookupProvider(clientName)
+	if !ok {
 		return nil, fmt.Errorf("client %s not exist", clientName)
 	}
-	return client.Init(options)
+	return factory(options)
+}
+
+// 字符串配置项，配置文件中没有加引号的数字解析为 json.Number，同样按原文作为字符串
+func optionString(data interface{}) (string, bool) {
+	switch value := data.(type) {
+	case string:
+		return value, true
+	case json.Number:
+		return value.String(), true
+	}
+	return "", false
 }
 
 func checkCommonStringKey(key string, options map[string]interface{}, errEmpty, errString error) (string, error) {
@@ -76,7 +282,7 @@ func checkCommonStringKey(key string, options map[string]interface{}, errEmpty,
 	if !ok {
 		return "", errEmpty
 	}
-	stringData, ok := data.(string)
+	stringData, ok := optionString(data)
 	if !ok {
 		return "", errString
 	}
@@ -98,3 +304,222 @@ func getAccessKeySecretKey(options map[string]interface{}) (string, string, erro
 	return accessKey, secretKey, nil
 }
 
+// 解析云存储返回的 ISO8601 时间，解析失败返回零值
+func parseISO8601(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// 分页标记由 keyMarker 和 uploadIdMarker 组成，对调用方不透明
+func encodeUploadMarker(keyMarker, uploadIdMarker string) string {
+	if keyMarker == "" && uploadIdMarker == "" {
+		return ""
+	}
+	return url.Values{"key": {keyMarker}, "uploadId": {uploadIdMarker}}.Encode()
+}
+
+func decodeUploadMarker(marker string) (string, string, error) {
+	if marker == "" {
+		return "", "", nil
+	}
+	values, err := url.ParseQuery(marker)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid marker %q: %w", marker, err)
+	}
+	return values.Get("key"), values.Get("uploadId"), nil
+}
+
+// 从响应头中提取用户自定义元数据，prefix 为各云存储的元数据前缀，如 x-oss-meta-
+func metadataFromHeader(header http.Header, prefix string) map[string]string {
+	metadata := make(map[string]string)
+	for key, values := range header {
+		key = strings.ToLower(key)
+		if strings.HasPrefix(key, prefix) && len(values) > 0 {
+			metadata[strings.TrimPrefix(key, prefix)] = values[0]
+		}
+	}
+	return metadata
+}
+
+func normalizeMetadata(metadata map[string]string) map[string]string {
+	normalized := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		normalized[strings.ToLower(key)] = value
+	}
+	return normalized
+}
+
+// 归类为 ErrObjectNotFound，同时保留原始错误，可以用 errors.As 取出
+func wrapNotFound(err error) error {
+	return &notFoundError{err: err}
+}
+
+type notFoundError struct {
+	err error
+}
+
+func (e *notFoundError) Error() string {
+	return ErrObjectNotFound.Error() + ": " + e.err.Error()
+}
+
+func (e *notFoundError) Unwrap() error {
+	return e.err
+}
+
+func (e *notFoundError) Is(target error) bool {
+	return target == ErrObjectNotFound
+}
+
+// 按 size 把 keys 分成多批
+func chunkKeys(keys []string, size int) [][]string {
+	chunks := make([][]string, 0, (len(keys)+size-1)/size)
+	for start := 0; start < len(keys); start += size {
+		end := start + size
+		if end > len(keys) {
+			end = len(keys)
+		}
+		chunks = append(chunks, keys[start:end])
+	}
+	return chunks
+}
+
+// 按 keys 的顺序生成批量删除结果，failed 中没有的 key 视为删除成功
+func deleteResults(keys []string, failed map[string]error) []DeleteResult {
+	results := make([]DeleteResult, 0, len(keys))
+	for _, key := range keys {
+		results = append(results, DeleteResult{
+			Key: key,
+			Err: failed[key],
+		})
+	}
+	return results
+}
+
+// 基于 marker 分页的接口在没有返回 NextMarker 时，使用本页最后一个对象或公共前缀作为下一页的标记
+func nextListMarker(isTruncated bool, nextMarker string, list *ObjectList) string {
+	if !isTruncated {
+		return ""
+	}
+	if nextMarker != "" {
+		return nextMarker
+	}
+	marker := ""
+	if n := len(list.Objects); n > 0 {
+		marker = list.Objects[n-1].Key
+	}
+	if n := len(list.CommonPrefixes); n > 0 && list.CommonPrefixes[n-1] > marker {
+		marker = list.CommonPrefixes[n-1]
+	}
+	return marker
+}
+
+// 使用分片上传复制大对象，失败时取消分片上传
+func multipartCopy(ctx context.Context, client StoreClient, bucketName, region, objectKey string, size int64, copyPart copyPartFunc) (*CompleteResult, error) {
+	uploadId, err := client.MultipartUploadInitWithContext(ctx, bucketName, region, objectKey)
+	if err != nil {
+		return nil, err
+	}
+	partSize := int64(copyPartSize)
+	for (size+partSize-1)/partSize > maxPartNumber {
+		partSize *= 2
+	}
+	parts := make(map[uint]string)
+	for partNumber, start := 1, int64(0); start < size; partNumber, start = partNumber+1, start+partSize {
+		end := start + partSize - 1
+		if end >= size {
+			end = size - 1
+		}
+		eTag, err := copyPart(uploadId, partNumber, start, end)
+		if err != nil {
+			_ = client.MultipartUploadAbortWithContext(context.Background(), bucketName, region, objectKey, uploadId)
+			return nil, err
+		}
+		parts[uint(partNumber)] = eTag
+	}
+	result, err := client.MultipartUploadCompleteWithContext(ctx, bucketName, region, objectKey, uploadId, parts)
+	if err != nil {
+		_ = client.MultipartUploadAbortWithContext(context.Background(), bucketName, region, objectKey, uploadId)
+		return nil, err
+	}
+	return result, nil
+}
+
+// 校验预签名的请求方法和有效期，返回大写的请求方法
+func checkPresign(method string, expiry time.Duration, allowed ...string) (string, error) {
+	if expiry <= 0 {
+		return "", ErrInvalidPresignExpiry
+	}
+	if len(allowed) == 0 {
+		allowed = []string{http.MethodGet, http.MethodPut, http.MethodHead, http.MethodDelete}
+	}
+	upperMethod := strings.ToUpper(method)
+	for _, allowedMethod := range allowed {
+		if upperMethod == allowedMethod {
+			return upperMethod, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnsupportedPresignMethod, method)
+}
+
+func checkPostPolicy(policy *PostPolicy) error {
+	if policy == nil {
+		return ErrEmptyPostPolicy
+	}
+	if policy.Expiry <= 0 {
+		return ErrInvalidPresignExpiry
+	}
+	if policy.MaxSize > 0 && policy.MinSize > policy.MaxSize {
+		return ErrInvalidPostPolicySize
+	}
+	return nil
+}
+
+// oss、cos、obs、bos 通用的 policy 条件，bucket 为各云存储 policy 中的空间名
+func (p *PostPolicy) conditions(bucket string) []interface{} {
+	conditions := []interface{}{
+		map[string]string{"bucket": bucket},
+	}
+	if p.Key != "" {
+		conditions = append(conditions, []string{"eq", "$key", p.Key})
+	} else {
+		conditions = append(conditions, []string{"starts-with", "$key", p.KeyPrefix})
+	}
+	if p.MaxSize > 0 {
+		conditions = append(conditions, []interface{}{"content-length-range", p.MinSize, p.MaxSize})
+	}
+	if strings.HasSuffix(p.ContentType, "/") {
+		conditions = append(conditions, []string{"starts-with", "$Content-Type", p.ContentType})
+	} else if p.ContentType != "" {
+		conditions = append(conditions, []string{"eq", "$Content-Type", p.ContentType})
+	}
+	return conditions
+}
+
+// 已经确定的表单字段，key 以 KeyPrefix 开头或 Content-Type 按前缀匹配时由浏览器填写
+func (p *PostPolicy) formFields() map[string]string {
+	fields := make(map[string]string)
+	if p.Key != "" {
+		fields["key"] = p.Key
+	}
+	if p.ContentType != "" && !strings.HasSuffix(p.ContentType, "/") {
+		fields["Content-Type"] = p.ContentType
+	}
+	return fields
+}
+
+// policy 文档的 json，签名时一般使用其 base64 编码
+func marshalPostPolicy(expiration time.Time, conditions []interface{}) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"expiration": expiration.UTC().Format("2006-01-02T15:04:05.000Z"),
+		"conditions": conditions,
+	})
+}
+
+func hmacSHA1(key []byte, data string) []byte {
+	mac := hmac.New(sha1.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -3,83 +3,138 @@ package go_cover_storage
 import (
 	"bytes"
 	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"github.com/tencentyun/cos-go-sdk-v5"
+	"io"
 	"net/http"
 	"net/url"
 	"sort"
+	"time"
 )
 
+// 开启版本控制后 cos 在该响应头中返回版本号
+const cosHeaderVersionId = "X-Cos-Version-Id"
+
 // 腾讯云存储 cos
 type tencent struct {
 	appId, secretId, secretKey string
+	connOptions
+	cache *clientCache
+}
+
+func init() {
+	Tencent = &tencent{}
+	mustRegisterProvider("tencent", Tencent.Init)
 }
 
+// 空间的访问域名，不带 scheme
+func (t *tencent) getCosBucketHost(bucketName, region string) string {
+	return bucketName + "-" + t.appId + "." + t.getEndpoint("cos."+t.getRegion(region)+".myqcloud.com")
+}
+
+// 每个空间的 cos.Client 只创建一次，共用同一个连接池
 func (t *tencent) getCosNewClient(bucketName, region string) (*cos.Client, error) {
-	u, _ := url.Parse("https://" + bucketName + "-" + t.appId + ".cos." + region + ".myqcloud.com")
-	b := &cos.BaseURL{BucketURL: u}
-	// 1.永久密钥
-	client := cos.NewClient(b, &http.Client{
-		Transport: &cos.AuthorizationTransport{
-			SecretID:  t.secretId,
-			SecretKey: t.secretKey,
-		},
+	bucketURL := t.getScheme("https") + "://" + t.getCosBucketHost(bucketName, region)
+	value, err := t.cache.get(cacheKey("cos", bucketURL), func() (interface{}, error) {
+		u, err := url.Parse(bucketURL)
+		if err != nil {
+			return nil, err
+		}
+		b := &cos.BaseURL{BucketURL: u}
+		// 1.永久密钥
+		client := cos.NewClient(b, &http.Client{
+			Transport: &cos.AuthorizationTransport{
+				SecretID:  t.secretId,
+				SecretKey: t.secretKey,
+				Transport: t.cache.transport(),
+			},
+			Timeout: t.timeout,
+		})
+		if client == nil {
+			return nil, errors.New("cannot initialize cos client")
+		}
+		return client, nil
 	})
-	if client == nil {
-		return nil, errors.New("cannot initialize cos client")
+	if err != nil {
+		return nil, err
 	}
-	return client, nil
+	return value.(*cos.Client), nil
+}
+
+func (t *tencent) Close() error {
+	t.cache.close()
+	return nil
 }
 
 func (t *tencent) Init(options map[string]interface{}) (StoreClient, error) {
-	appId, err := checkCommonStringKey("appId", options, ErrEmptyAppId, ErrStringAppId)
-	if err != nil {
-		return nil, err
-	}
-	accessKey, secretKey, err := getAccessKeySecretKey(options)
-	if err != nil {
-		return nil, err
-	}
-	t.appId = appId
-	t.secretId = accessKey
-	t.secretKey = secretKey
-	return &tencent{
-		appId:     appId,
-		secretId:  accessKey,
-		secretKey: secretKey,
-	}, nil
+	return initClient("tencent", options)
 }
 
 func (t *tencent) MultipartUploadInit(bucketName, region, objectKey string) (string, error) {
+	return t.MultipartUploadInitWithContext(context.Background(), bucketName, region, objectKey)
+}
+
+func (t *tencent) MultipartUploadInitWithContext(ctx context.Context, bucketName, region, objectKey string) (string, error) {
 	client, err := t.getCosNewClient(bucketName, region)
 	if err != nil {
 		return "", err
 	}
-	v, _, err := client.Object.InitiateMultipartUpload(context.Background(), objectKey, nil)
+	v, _, err := client.Object.InitiateMultipartUpload(ctx, objectKey, nil)
 	if err != nil {
 		return "", err
 	}
 	return v.UploadID, nil
 }
 
-func (t *tencent) MultipartUploadPart(bucketName, region, objectKey, uploadId string, partNumber uint, body []byte) (H, error) {
+func (t *tencent) MultipartUploadPart(bucketName, region, objectKey, uploadId string, partNumber uint, body []byte) (*UploadPartResult, error) {
+	return t.MultipartUploadPartWithContext(context.Background(), bucketName, region, objectKey, uploadId, partNumber, body)
+}
+
+func (t *tencent) MultipartUploadPartWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string, partNumber uint, body []byte) (*UploadPartResult, error) {
+	return t.MultipartUploadPartFromReaderWithContext(ctx, bucketName, region, objectKey, uploadId, partNumber, bytes.NewReader(body), int64(len(body)))
+}
+
+func (t *tencent) MultipartUploadPartFromReader(bucketName, region, objectKey, uploadId string, partNumber uint, reader io.Reader, size int64) (*UploadPartResult, error) {
+	return t.MultipartUploadPartFromReaderWithContext(context.Background(), bucketName, region, objectKey, uploadId, partNumber, reader, size)
+}
+
+func (t *tencent) MultipartUploadPartFromReaderWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string, partNumber uint, reader io.Reader, size int64) (*UploadPartResult, error) {
 	client, err := t.getCosNewClient(bucketName, region)
 	if err != nil {
 		return nil, err
 	}
+	// reader 不是 bytes.Reader 时必须指定 ContentLength
+	opt := &cos.ObjectUploadPartOptions{
+		ContentLength: int(size),
+	}
+	progress := startPartProgress(ctx, "tencent", bucketName, objectKey, uploadId, partNumber, size)
+	checksumReader := newChecksumReader(io.LimitReader(reader, size))
 	resp, err := client.Object.UploadPart(
-		context.Background(), objectKey, uploadId, int(partNumber), bytes.NewReader(body), nil,
+		ctx, objectKey, uploadId, int(partNumber), progress.reader(checksumReader), opt,
 	)
 	if err != nil {
+		progress.finish(nil, err)
 		return nil, err
 	}
-	return H{
-		"PartNumber": int(partNumber),
-		"ETag":       resp.Header.Get("ETag"),
-	}, nil
+	result := &UploadPartResult{
+		PartNumber: partNumber,
+		ETag:       resp.Header.Get("ETag"),
+		Size:       size,
+		Checksum:   checksumReader.Checksum(),
+	}
+	progress.finish(result, nil)
+	return result, nil
+}
+
+func (t *tencent) MultipartUploadComplete(bucketName, region, objectKey, uploadId string, parts map[uint]string) (*CompleteResult, error) {
+	return t.MultipartUploadCompleteWithContext(context.Background(), bucketName, region, objectKey, uploadId, parts)
 }
 
-func (t *tencent) MultipartUploadComplete(bucketName, region, objectKey, uploadId string, parts map[uint]string) (H, error) {
+func (t *tencent) MultipartUploadCompleteWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string, parts map[uint]string) (*CompleteResult, error) {
 	client, err := t.getCosNewClient(bucketName, region)
 	if err != nil {
 		return nil, err
@@ -98,16 +153,386 @@ func (t *tencent) MultipartUploadComplete(bucketName, region, objectKey, uploadI
 	opt := &cos.CompleteMultipartUploadOptions{
 		Parts: optParts,
 	}
-	result, _, err := client.Object.CompleteMultipartUpload(
-		context.Background(), objectKey, uploadId, opt,
+	result, resp, err := client.Object.CompleteMultipartUpload(
+		ctx, objectKey, uploadId, opt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &CompleteResult{
+		Bucket:    result.Bucket,
+		Key:       result.Key,
+		ETag:      result.ETag,
+		Location:  result.Location,
+		VersionID: resp.Header.Get(cosHeaderVersionId),
+	}, nil
+}
+
+func (t *tencent) MultipartUploadAbort(bucketName, region, objectKey, uploadId string) error {
+	return t.MultipartUploadAbortWithContext(context.Background(), bucketName, region, objectKey, uploadId)
+}
+
+func (t *tencent) MultipartUploadAbortWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string) error {
+	client, err := t.getCosNewClient(bucketName, region)
+	if err != nil {
+		return err
+	}
+	_, err = client.Object.AbortMultipartUpload(ctx, objectKey, uploadId)
+	return err
+}
+
+func (t *tencent) MultipartUploadListParts(bucketName, region, objectKey, uploadId string) ([]Part, error) {
+	return t.MultipartUploadListPartsWithContext(context.Background(), bucketName, region, objectKey, uploadId)
+}
+
+func (t *tencent) MultipartUploadListPartsWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string) ([]Part, error) {
+	client, err := t.getCosNewClient(bucketName, region)
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]Part, 0)
+	opt := &cos.ObjectListPartsOptions{}
+	for {
+		result, _, err := client.Object.ListParts(ctx, objectKey, uploadId, opt)
+		if err != nil {
+			return nil, err
+		}
+		for _, part := range result.Parts {
+			parts = append(parts, Part{
+				PartNumber:   part.PartNumber,
+				ETag:         part.ETag,
+				Size:         part.Size,
+				LastModified: parseISO8601(part.LastModified),
+			})
+		}
+		if !result.IsTruncated {
+			return parts, nil
+		}
+		opt.PartNumberMarker = result.NextPartNumberMarker
+	}
+}
+
+func (t *tencent) ListMultipartUploads(bucketName, region, prefix, marker string, maxUploads int) (*MultipartUploadList, error) {
+	return t.ListMultipartUploadsWithContext(context.Background(), bucketName, region, prefix, marker, maxUploads)
+}
+
+func (t *tencent) ListMultipartUploadsWithContext(ctx context.Context, bucketName, region, prefix, marker string, maxUploads int) (*MultipartUploadList, error) {
+	keyMarker, uploadIdMarker, err := decodeUploadMarker(marker)
+	if err != nil {
+		return nil, err
+	}
+	if maxUploads <= 0 {
+		maxUploads = defaultMaxUploads
+	}
+	client, err := t.getCosNewClient(bucketName, region)
+	if err != nil {
+		return nil, err
+	}
+	opt := &cos.ListMultipartUploadsOptions{
+		Prefix:         prefix,
+		MaxUploads:     maxUploads,
+		KeyMarker:      keyMarker,
+		UploadIDMarker: uploadIdMarker,
+	}
+	result, _, err := client.Bucket.ListMultipartUploads(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+	list := &MultipartUploadList{Uploads: make([]MultipartUpload, 0, len(result.Uploads))}
+	for _, upload := range result.Uploads {
+		list.Uploads = append(list.Uploads, MultipartUpload{
+			Key:       upload.Key,
+			UploadId:  upload.UploadID,
+			Initiated: parseISO8601(upload.Initiated),
+		})
+	}
+	if result.IsTruncated {
+		list.NextMarker = encodeUploadMarker(result.NextKeyMarker, result.NextUploadIDMarker)
+	}
+	return list, nil
+}
+
+func (t *tencent) PutObject(bucketName, region, objectKey string, reader io.Reader, size int64, opts *PutObjectOptions) (*CompleteResult, error) {
+	return t.PutObjectWithContext(context.Background(), bucketName, region, objectKey, reader, size, opts)
+}
+
+func (t *tencent) PutObjectWithContext(ctx context.Context, bucketName, region, objectKey string, reader io.Reader, size int64, opts *PutObjectOptions) (*CompleteResult, error) {
+	client, err := t.getCosNewClient(bucketName, region)
+	if err != nil {
+		return nil, err
+	}
+	headerOpt := &cos.ObjectPutHeaderOptions{
+		ContentLength: int(size),
+	}
+	if opts != nil {
+		headerOpt.ContentType = opts.ContentType
+		if len(opts.Metadata) > 0 {
+			meta := http.Header{}
+			for key, value := range opts.Metadata {
+				meta.Set("x-cos-meta-"+key, value)
+			}
+			headerOpt.XCosMetaXXX = &meta
+		}
+	}
+	resp, err := client.Object.Put(ctx, objectKey, io.LimitReader(reader, size), &cos.ObjectPutOptions{
+		ObjectPutHeaderOptions: headerOpt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &CompleteResult{
+		Bucket:    bucketName,
+		Key:       objectKey,
+		ETag:      resp.Header.Get("ETag"),
+		VersionID: resp.Header.Get(cosHeaderVersionId),
+	}, nil
+}
+
+func (t *tencent) GetObject(bucketName, region, objectKey string, opts *GetObjectOptions) (io.ReadCloser, error) {
+	return t.GetObjectWithContext(context.Background(), bucketName, region, objectKey, opts)
+}
+
+func (t *tencent) GetObjectWithContext(ctx context.Context, bucketName, region, objectKey string, opts *GetObjectOptions) (io.ReadCloser, error) {
+	client, err := t.getCosNewClient(bucketName, region)
+	if err != nil {
+		return nil, err
+	}
+	opt := &cos.ObjectGetOptions{}
+	if byteRange := opts.byteRange(); byteRange != nil {
+		opt.Range = byteRange.String()
+	}
+	resp, err := client.Object.Get(ctx, objectKey, opt)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (t *tencent) StatObject(bucketName, region, objectKey string) (*ObjectInfo, error) {
+	return t.StatObjectWithContext(context.Background(), bucketName, region, objectKey)
+}
+
+func (t *tencent) StatObjectWithContext(ctx context.Context, bucketName, region, objectKey string) (*ObjectInfo, error) {
+	client, err := t.getCosNewClient(bucketName, region)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Object.Head(ctx, objectKey, nil)
+	if err != nil {
+		if cos.IsNotFoundError(err) {
+			return nil, wrapNotFound(err)
+		}
+		return nil, err
+	}
+	lastModified, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return &ObjectInfo{
+		Key:          objectKey,
+		Size:         resp.ContentLength,
+		ETag:         resp.Header.Get("ETag"),
+		ContentType:  resp.Header.Get("Content-Type"),
+		LastModified: lastModified,
+		Metadata:     metadataFromHeader(resp.Header, "x-cos-meta-"),
+	}, nil
+}
+
+func (t *tencent) DeleteObject(bucketName, region, objectKey string) error {
+	return t.DeleteObjectWithContext(context.Background(), bucketName, region, objectKey)
+}
+
+func (t *tencent) DeleteObjectWithContext(ctx context.Context, bucketName, region, objectKey string) error {
+	client, err := t.getCosNewClient(bucketName, region)
+	if err != nil {
+		return err
+	}
+	_, err = client.Object.Delete(ctx, objectKey)
+	return err
+}
+
+func (t *tencent) DeleteObjects(bucketName, region string, objectKeys []string) ([]DeleteResult, error) {
+	return t.DeleteObjectsWithContext(context.Background(), bucketName, region, objectKeys)
+}
+
+func (t *tencent) DeleteObjectsWithContext(ctx context.Context, bucketName, region string, objectKeys []string) ([]DeleteResult, error) {
+	client, err := t.getCosNewClient(bucketName, region)
+	if err != nil {
+		return nil, err
+	}
+	failed := make(map[string]error)
+	for _, keys := range chunkKeys(objectKeys, maxDeleteObjects) {
+		opt := &cos.ObjectDeleteMultiOptions{
+			Quiet:   true,
+			Objects: make([]cos.Object, 0, len(keys)),
+		}
+		for _, key := range keys {
+			opt.Objects = append(opt.Objects, cos.Object{Key: key})
+		}
+		result, _, err := client.Object.DeleteMulti(ctx, opt)
+		if err != nil {
+			return nil, err
+		}
+		for _, deleteErr := range result.Errors {
+			failed[deleteErr.Key] = fmt.Errorf("%s: %s", deleteErr.Code, deleteErr.Message)
+		}
+	}
+	return deleteResults(objectKeys, failed), nil
+}
+
+func (t *tencent) ListObjects(bucketName, region, prefix, delimiter, continuationToken string, maxKeys int) (*ObjectList, error) {
+	return t.ListObjectsWithContext(context.Background(), bucketName, region, prefix, delimiter, continuationToken, maxKeys)
+}
+
+// cos 使用 marker 分页，continuationToken 即为 marker
+func (t *tencent) ListObjectsWithContext(ctx context.Context, bucketName, region, prefix, delimiter, continuationToken string, maxKeys int) (*ObjectList, error) {
+	client, err := t.getCosNewClient(bucketName, region)
+	if err != nil {
+		return nil, err
+	}
+	if maxKeys <= 0 {
+		maxKeys = defaultMaxKeys
+	}
+	opt := &cos.BucketGetOptions{
+		Prefix:    prefix,
+		Delimiter: delimiter,
+		Marker:    continuationToken,
+		MaxKeys:   maxKeys,
+	}
+	result, _, err := client.Bucket.Get(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+	list := &ObjectList{
+		Objects:        make([]ObjectInfo, 0, len(result.Contents)),
+		CommonPrefixes: result.CommonPrefixes,
+	}
+	for _, object := range result.Contents {
+		list.Objects = append(list.Objects, ObjectInfo{
+			Key:          object.Key,
+			Size:         object.Size,
+			ETag:         object.ETag,
+			LastModified: parseISO8601(object.LastModified),
+		})
+	}
+	list.NextContinuationToken = nextListMarker(result.IsTruncated, result.NextMarker, list)
+	return list, nil
+}
+
+func (t *tencent) CopyObject(bucketName, region, objectKey, srcBucketName, srcObjectKey string) (*CompleteResult, error) {
+	return t.CopyObjectWithContext(context.Background(), bucketName, region, objectKey, srcBucketName, srcObjectKey)
+}
+
+func (t *tencent) CopyObjectWithContext(ctx context.Context, bucketName, region, objectKey, srcBucketName, srcObjectKey string) (*CompleteResult, error) {
+	srcInfo, err := t.StatObjectWithContext(ctx, srcBucketName, region, srcObjectKey)
+	if err != nil {
+		return nil, err
+	}
+	client, err := t.getCosNewClient(bucketName, region)
+	if err != nil {
+		return nil, err
+	}
+	srcHost := t.getCosBucketHost(srcBucketName, region)
+	if srcInfo.Size > maxCopyObjectSize {
+		// CopyPart 不会对源对象的 key 编码
+		sourceURL := srcHost + (&url.URL{Path: "/" + srcObjectKey}).EscapedPath()
+		return multipartCopy(ctx, t, bucketName, region, objectKey, srcInfo.Size, func(uploadId string, partNumber int, start, end int64) (string, error) {
+			opt := &cos.ObjectCopyPartOptions{
+				XCosCopySourceRange: fmt.Sprintf("bytes=%d-%d", start, end),
+			}
+			result, _, err := client.Object.CopyPart(ctx, objectKey, uploadId, partNumber, sourceURL, opt)
+			if err != nil {
+				return "", err
+			}
+			return result.ETag, nil
+		})
+	}
+	result, _, err := client.Object.Copy(ctx, objectKey, srcHost+"/"+srcObjectKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &CompleteResult{
+		Bucket:    bucketName,
+		Key:       objectKey,
+		ETag:      result.ETag,
+		VersionID: result.VersionId,
+	}, nil
+}
+
+func (t *tencent) PresignURL(method, bucketName, region, objectKey string, expiry time.Duration) (string, error) {
+	method, err := checkPresign(method, expiry)
+	if err != nil {
+		return "", err
+	}
+	client, err := t.getCosNewClient(bucketName, region)
+	if err != nil {
+		return "", err
+	}
+	presignedURL, err := client.Object.GetPresignedURL(context.Background(), method, objectKey, t.secretId, t.secretKey, expiry, nil)
+	if err != nil {
+		return "", err
+	}
+	return presignedURL.String(), nil
+}
+
+// 分片上传的查询参数，需要参与签名
+type cosUploadPartQuery struct {
+	PartNumber uint   `url:"partNumber"`
+	UploadID   string `url:"uploadId"`
+}
+
+// 分片的 ETag 在响应头 ETag 中，浏览器读取需要在 bucket 的 CORS 规则中暴露 ETag
+func (t *tencent) PresignMultipartUploadPart(bucketName, region, objectKey, uploadId string, partNumber uint, expiry time.Duration) (*PresignedPartRequest, error) {
+	if _, err := checkPresign(http.MethodPut, expiry); err != nil {
+		return nil, err
+	}
+	client, err := t.getCosNewClient(bucketName, region)
+	if err != nil {
+		return nil, err
+	}
+	expiration := time.Now().Add(expiry)
+	query := &cosUploadPartQuery{
+		PartNumber: partNumber,
+		UploadID:   uploadId,
+	}
+	presignedURL, err := client.Object.GetPresignedURL(context.Background(), http.MethodPut, objectKey, t.secretId, t.secretKey, expiry, query)
+	if err != nil {
+		return nil, err
+	}
+	return &PresignedPartRequest{
+		PartNumber: partNumber,
+		Method:     http.MethodPut,
+		URL:        presignedURL.String(),
+		Header:     http.Header{},
+		Expiration: expiration,
+	}, nil
+}
+
+// cos 的表单签名需要把签名参数也写入 policy 条件
+func (t *tencent) PresignPostPolicy(bucketName, region string, policy *PostPolicy) (*PostPolicyForm, error) {
+	if err := checkPostPolicy(policy); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	expiration := now.Add(policy.Expiry)
+	keyTime := fmt.Sprintf("%d;%d", now.Unix(), expiration.Unix())
+	conditions := append(policy.conditions(bucketName+"-"+t.appId),
+		map[string]string{"q-sign-algorithm": "sha1"},
+		map[string]string{"q-ak": t.secretId},
+		map[string]string{"q-sign-time": keyTime},
 	)
+	document, err := marshalPostPolicy(expiration, conditions)
 	if err != nil {
 		return nil, err
 	}
-	return H{
-		"Location": result.Location,
-		"Bucket":   result.Bucket,
-		"ETag":     result.ETag,
-		"Key":      result.Key,
+	signKey := hex.EncodeToString(hmacSHA1([]byte(t.secretKey), keyTime))
+	stringToSign := fmt.Sprintf("%x", sha1.Sum(document))
+	fields := policy.formFields()
+	fields["policy"] = base64.StdEncoding.EncodeToString(document)
+	fields["q-sign-algorithm"] = "sha1"
+	fields["q-ak"] = t.secretId
+	fields["q-key-time"] = keyTime
+	fields["q-signature"] = hex.EncodeToString(hmacSHA1([]byte(signKey), stringToSign))
+	return &PostPolicyForm{
+		URL:        t.getScheme("https") + "://" + t.getCosBucketHost(bucketName, region),
+		Fields:     fields,
+		Expiration: expiration,
 	}, nil
 }
@@ -0,0 +1,409 @@
+package go_cover_storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// 默认分片大小
+	defaultUploadPartSize = 8 << 20
+	// 各云存储分片最小 100KB 到 5MB 不等，按最大的限制
+	minUploadPartSize = 5 << 20
+	// 默认同时上传的分片数
+	defaultUploadConcurrency = 4
+	// 分片失败后默认的重试次数
+	defaultUploadRetries = 3
+	// 第一次重试前的等待时间，之后每次翻倍
+	defaultUploadRetryDelay = time.Second
+	// 上传失败后取消分片上传的默认超时时间
+	defaultUploadAbortTimeout = 30 * time.Second
+)
+
+// 并发上传文件或数据流
+// 小于 SingleShotThreshold 的数据使用 PutObject 一次上传，其他使用分片上传，
+// 分片由多个 goroutine 同时上传，失败的分片自动重试，全部成功后完成分片上传，失败时取消分片上传
+type Uploader struct {
+	Client StoreClient
+	// 分片大小，为 0 时使用默认值，已知总大小时会自动增大，保证分片数不超过 10000
+	PartSize int64
+	// 同时上传的分片数，为 0 时使用默认值
+	Concurrency int
+	// 单个分片遇到可以重试的错误（见 IsRetryable）后的重试次数，为 0 时使用默认值，小于 0 不重试
+	MaxRetries int
+	// 第一次重试前的等待时间，为 0 时使用默认值
+	RetryDelay time.Duration
+	// 上传失败后取消分片上传的超时时间，为 0 时使用默认值
+	AbortTimeout time.Duration
+	// 不超过该大小时使用 PutObject，为 0 时与分片大小相同
+	SingleShotThreshold int64
+	// 不为空时 UploadFile 在该目录中保存断点，见 UploadCheckpoint
+	CheckpointDir string
+	// 分片上传的进度回调，SentBytes、TotalBytes 和 ETA 为整个上传的进度，PutObject 上传时没有进度事件
+	Progress ProgressListener
+}
+
+var (
+	ErrEmptyUploaderClient = errors.New("uploader client cannot be empty")
+	ErrUploadTooLarge      = errors.New("upload exceeds the maximum number of parts")
+	// 分片上传不支持 PutObjectOptions，数据超过 SingleShotThreshold 时不能设置 ContentType 和 Metadata
+	ErrMultipartUploadOptions = errors.New("content type and metadata are not supported by multipart upload")
+)
+
+// 上传失败后取消分片上传也失败时返回，Err 为上传失败的原因，AbortErr 为取消失败的原因
+// 分片上传可能还留在云存储中，需要使用 UploadId 重新取消
+type UploadAbortError struct {
+	UploadId string
+	Err      error
+	AbortErr error
+}
+
+func (e *UploadAbortError) Error() string {
+	return fmt.Sprintf("%v (abort upload %s: %v)", e.Err, e.UploadId, e.AbortErr)
+}
+
+func (e *UploadAbortError) Unwrap() error {
+	return e.Err
+}
+
+func NewUploader(client StoreClient) *Uploader {
+	return &Uploader{Client: client}
+}
+
+// 等待上传的分片，data 为 nil 时从 readerAt 的 offset 处读取
+type uploadPartJob struct {
+	partNumber uint
+	offset     int64
+	size       int64
+	data       []byte
+}
+
+func (u *Uploader) concurrency() int {
+	if u.Concurrency > 0 {
+		return u.Concurrency
+	}
+	return defaultUploadConcurrency
+}
+
+func (u *Uploader) maxRetries() int {
+	if u.MaxRetries == 0 {
+		return defaultUploadRetries
+	}
+	if u.MaxRetries < 0 {
+		return 0
+	}
+	return u.MaxRetries
+}
+
+func (u *Uploader) abortTimeout() time.Duration {
+	if u.AbortTimeout > 0 {
+		return u.AbortTimeout
+	}
+	return defaultUploadAbortTimeout
+}
+
+func (u *Uploader) retryDelay() time.Duration {
+	if u.RetryDelay > 0 {
+		return u.RetryDelay
+	}
+	return defaultUploadRetryDelay
+}
+
+// 分片大小，size 小于 0 表示总大小未知
+func (u *Uploader) partSize(size int64) int64 {
+	partSize := u.PartSize
+	if partSize <= 0 {
+		partSize = defaultUploadPartSize
+	}
+	if partSize < minUploadPartSize {
+		partSize = minUploadPartSize
+	}
+	for size > 0 && (size+partSize-1)/partSize > maxPartNumber {
+		partSize *= 2
+	}
+	return partSize
+}
+
+func (u *Uploader) singleShotThreshold(partSize int64) int64 {
+	if u.SingleShotThreshold > 0 {
+		return u.SingleShotThreshold
+	}
+	return partSize
+}
+
+// 上传本地文件，需要分片上传时与 Upload 相同，opts 不为空返回 ErrMultipartUploadOptions
+func (u *Uploader) UploadFile(ctx context.Context, bucketName, region, objectKey, filename string, opts *PutObjectOptions) (*CompleteResult, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if u.CheckpointDir != "" && u.Client != nil && info.Size() > u.singleShotThreshold(u.partSize(info.Size())) {
+		return u.uploadFileWithCheckpoint(ctx, bucketName, region, objectKey, file, info, opts)
+	}
+	return u.Upload(ctx, bucketName, region, objectKey, file, info.Size(), opts)
+}
+
+// 上传 reader 中的数据，size 小于 0 表示大小未知，读取到 EOF 为止
+// reader 同时实现了 io.ReaderAt 和 io.Seeker 时，分片直接从 reader 的当前位置按区间读取，
+// 其他 reader 按顺序读入内存，最多同时占用 Concurrency+1 个分片大小的内存
+// 分片上传不支持设置 ContentType 和 Metadata，opts 不为空且需要分片上传时返回 ErrMultipartUploadOptions
+// size 不小于 0 时 reader 中的数据不足 size 会取消上传并返回 io.ErrUnexpectedEOF
+func (u *Uploader) Upload(ctx context.Context, bucketName, region, objectKey string, reader io.Reader, size int64, opts *PutObjectOptions) (*CompleteResult, error) {
+	if u.Client == nil {
+		return nil, ErrEmptyUploaderClient
+	}
+	partSize := u.partSize(size)
+	threshold := u.singleShotThreshold(partSize)
+	if size >= 0 && size <= threshold {
+		return u.Client.PutObjectWithContext(ctx, bucketName, region, objectKey, reader, size, opts)
+	}
+	if size >= 0 && hasPutObjectOptions(opts) {
+		return nil, ErrMultipartUploadOptions
+	}
+	ctx, _ = u.withProgress(ctx, size)
+	if readerAt, ok := reader.(io.ReaderAt); ok && size >= 0 {
+		if seeker, ok := reader.(io.Seeker); ok {
+			offset, err := seeker.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return nil, err
+			}
+			return u.uploadReaderAt(ctx, bucketName, region, objectKey, readerAt, offset, size, partSize)
+		}
+	}
+	if size >= 0 {
+		reader = io.LimitReader(reader, size)
+	} else {
+		// 大小未知时先读取 threshold+1 字节，数据不多时使用 PutObject
+		head, err := ioutil.ReadAll(io.LimitReader(reader, threshold+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(head)) <= threshold {
+			return u.Client.PutObjectWithContext(ctx, bucketName, region, objectKey, bytes.NewReader(head), int64(len(head)), opts)
+		}
+		if hasPutObjectOptions(opts) {
+			return nil, ErrMultipartUploadOptions
+		}
+		reader = io.MultiReader(bytes.NewReader(head), reader)
+	}
+	return u.uploadStream(ctx, bucketName, region, objectKey, reader, size, partSize)
+}
+
+func hasPutObjectOptions(opts *PutObjectOptions) bool {
+	return opts != nil && (opts.ContentType != "" || len(opts.Metadata) > 0)
+}
+
+// 设置了 Progress 时返回汇总进度的 ctx，total 小于 0 表示总大小未知
+func (u *Uploader) withProgress(ctx context.Context, total int64) (context.Context, *uploadProgress) {
+	if u.Progress == nil {
+		return ctx, nil
+	}
+	if total < 0 {
+		total = -1
+	}
+	progress := newUploadProgress(u.Progress, total)
+	return WithProgress(ctx, progress.handle), progress
+}
+
+// 从 readerAt 的 [offset, offset+size) 区间并发读取分片
+func (u *Uploader) uploadReaderAt(ctx context.Context, bucketName, region, objectKey string, readerAt io.ReaderAt, offset, size, partSize int64) (*CompleteResult, error) {
+	return u.uploadMultipart(ctx, bucketName, region, objectKey, readerAt, readerAtParts(offset, size, partSize, nil))
+}
+
+// 按 partSize 划分 readerAt 的 [offset, offset+size) 区间，跳过 skip 中的分片
+func readerAtParts(offset, size, partSize int64, skip map[uint]bool) producePartsFunc {
+	return func(ctx context.Context, jobs chan<- uploadPartJob, release <-chan []byte) error {
+		partNumber := uint(1)
+		for start := int64(0); start < size; start += partSize {
+			partLength := partSize
+			if start+partLength > size {
+				partLength = size - start
+			}
+			if !skip[partNumber] {
+				select {
+				case jobs <- uploadPartJob{partNumber: partNumber, offset: offset + start, size: partLength}:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			partNumber++
+		}
+		return nil
+	}
+}
+
+// 按顺序读取 reader，每个分片读入一块缓冲区，缓冲区在分片上传完成后复用
+// size 不小于 0 时读取的数据不足 size 返回 io.ErrUnexpectedEOF，取消分片上传
+func (u *Uploader) uploadStream(ctx context.Context, bucketName, region, objectKey string, reader io.Reader, size, partSize int64) (*CompleteResult, error) {
+	return u.uploadMultipart(ctx, bucketName, region, objectKey, nil, func(ctx context.Context, jobs chan<- uploadPartJob, release <-chan []byte) error {
+		var total int64
+		checkSize := func() error {
+			if size >= 0 && total < size {
+				return io.ErrUnexpectedEOF
+			}
+			return nil
+		}
+		allocated := 0
+		for partNumber := uint(1); ; partNumber++ {
+			var buffer []byte
+			if allocated < u.concurrency()+1 {
+				buffer = make([]byte, partSize)
+				allocated++
+			} else {
+				select {
+				case buffer = <-release:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			n, err := io.ReadFull(reader, buffer[:partSize])
+			total += int64(n)
+			if err == io.EOF {
+				return checkSize()
+			}
+			if err != nil && err != io.ErrUnexpectedEOF {
+				return err
+			}
+			if partNumber > maxPartNumber {
+				return fmt.Errorf("%w: part size %d", ErrUploadTooLarge, partSize)
+			}
+			select {
+			case jobs <- uploadPartJob{partNumber: partNumber, size: int64(n), data: buffer[:n]}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			if err == io.ErrUnexpectedEOF {
+				return checkSize()
+			}
+		}
+	})
+}
+
+// 生成分片的函数，release 中返回上传完成的分片数据，用于复用缓冲区
+type producePartsFunc func(ctx context.Context, jobs chan<- uploadPartJob, release <-chan []byte) error
+
+// 初始化分片上传，由 produce 生成分片，多个 goroutine 并发上传，最后完成或取消分片上传
+func (u *Uploader) uploadMultipart(ctx context.Context, bucketName, region, objectKey string, readerAt io.ReaderAt, produce producePartsFunc) (*CompleteResult, error) {
+	uploadId, err := u.Client.MultipartUploadInitWithContext(ctx, bucketName, region, objectKey)
+	if err != nil {
+		return nil, err
+	}
+	parts := make(map[uint]string)
+	if err = u.uploadParts(ctx, bucketName, region, objectKey, uploadId, readerAt, parts, nil, produce); err == nil {
+		var result *CompleteResult
+		if result, err = u.Client.MultipartUploadCompleteWithContext(ctx, bucketName, region, objectKey, uploadId, parts); err == nil {
+			return result, nil
+		}
+	}
+	if abortErr := u.abortMultipart(bucketName, region, objectKey, uploadId); abortErr != nil {
+		return nil, &UploadAbortError{UploadId: uploadId, Err: err, AbortErr: abortErr}
+	}
+	return nil, err
+}
+
+// ctx 可能已经取消，使用新的带超时的 ctx 取消分片上传
+func (u *Uploader) abortMultipart(bucketName, region, objectKey, uploadId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), u.abortTimeout())
+	defer cancel()
+	return u.Client.MultipartUploadAbortWithContext(ctx, bucketName, region, objectKey, uploadId)
+}
+
+// 并发上传 produce 生成的分片，成功的分片写入 parts
+// partDone 不为 nil 时在每个分片成功后调用，调用时持有锁，返回错误会停止上传
+func (u *Uploader) uploadParts(ctx context.Context, bucketName, region, objectKey, uploadId string, readerAt io.ReaderAt, parts map[uint]string, partDone func() error, produce producePartsFunc) error {
+	uploadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	concurrency := u.concurrency()
+	jobs := make(chan uploadPartJob)
+	release := make(chan []byte, concurrency+1)
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	setErr := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+		cancel()
+	}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				// 已经失败时不再上传剩余的分片
+				var eTag string
+				err := uploadCtx.Err()
+				if err == nil {
+					eTag, err = u.uploadPart(uploadCtx, bucketName, region, objectKey, uploadId, readerAt, job)
+				}
+				if job.data != nil {
+					release <- job.data[:cap(job.data)]
+				}
+				if err != nil {
+					setErr(err)
+					continue
+				}
+				mu.Lock()
+				parts[job.partNumber] = eTag
+				if partDone != nil {
+					err = partDone()
+				}
+				mu.Unlock()
+				if err != nil {
+					setErr(err)
+				}
+			}
+		}()
+	}
+	if err := produce(uploadCtx, jobs, release); err != nil {
+		setErr(err)
+	}
+	close(jobs)
+	wg.Wait()
+	return firstErr
+}
+
+// 上传一个分片，失败时按 RetryDelay 指数退避重试
+func (u *Uploader) uploadPart(ctx context.Context, bucketName, region, objectKey, uploadId string, readerAt io.ReaderAt, job uploadPartJob) (string, error) {
+	delay := u.retryDelay()
+	for attempt := 0; ; attempt++ {
+		var body io.Reader
+		if job.data != nil {
+			body = bytes.NewReader(job.data)
+		} else {
+			body = io.NewSectionReader(readerAt, job.offset, job.size)
+		}
+		result, err := u.Client.MultipartUploadPartFromReaderWithContext(ctx, bucketName, region, objectKey, uploadId, job.partNumber, body, job.size)
+		if err == nil {
+			return result.ETag, nil
+		}
+		if attempt >= u.maxRetries() || !IsRetryable(err) {
+			return "", err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return "", err
+		}
+		delay *= 2
+	}
+}
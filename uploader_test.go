@@ -0,0 +1,216 @@
+package go_cover_storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 前 failures 次上传分片返回 err 的客户端
+type flakyClient struct {
+	StoreClient
+	failures int32
+	err      error
+	attempts int32
+}
+
+func (c *flakyClient) MultipartUploadPartFromReaderWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string, partNumber uint, reader io.Reader, size int64) (*UploadPartResult, error) {
+	if atomic.AddInt32(&c.attempts, 1) <= c.failures {
+		return nil, c.err
+	}
+	return c.StoreClient.MultipartUploadPartFromReaderWithContext(ctx, bucketName, region, objectKey, uploadId, partNumber, reader, size)
+}
+
+// 不实现 io.ReaderAt 的 reader，Uploader 按顺序读取
+type streamReader struct {
+	reader io.Reader
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	return r.reader.Read(p)
+}
+
+func readObject(t *testing.T, client StoreClient, objectKey string) []byte {
+	t.Helper()
+	body, err := client.GetObject("bucket", "", objectKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func checkNoUploads(t *testing.T, client StoreClient) {
+	t.Helper()
+	list, err := client.ListMultipartUploads("bucket", "", "", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Uploads) != 0 {
+		t.Errorf("uploads left: %+v", list.Uploads)
+	}
+}
+
+func TestUploaderUpload(t *testing.T) {
+	client, cleanup := newTestLocalClient(t)
+	defer cleanup()
+	content := testContent(12 << 20)
+	uploader := &Uploader{Client: client, PartSize: minUploadPartSize, Concurrency: 2}
+	tests := map[string]struct {
+		reader io.Reader
+		size   int64
+	}{
+		"readerAt":     {bytes.NewReader(content), int64(len(content))},
+		"stream":       {&streamReader{bytes.NewReader(content)}, int64(len(content))},
+		"unknown size": {&streamReader{bytes.NewReader(content)}, -1},
+		"small":        {bytes.NewReader(content[:100]), 100},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := uploader.Upload(context.Background(), "bucket", "", name, test.reader, test.size, nil); err != nil {
+				t.Fatal(err)
+			}
+			want := content
+			if test.size >= 0 {
+				want = content[:test.size]
+			}
+			if !bytes.Equal(readObject(t, client, name), want) {
+				t.Error("uploaded content does not match")
+			}
+		})
+	}
+	checkNoUploads(t, client)
+}
+
+// 分片上传无法设置 ContentType 和 Metadata，不能静默丢弃
+func TestUploaderRejectsOptionsForMultipart(t *testing.T) {
+	client, cleanup := newTestLocalClient(t)
+	defer cleanup()
+	content := testContent(6 << 20)
+	uploader := &Uploader{Client: client, PartSize: minUploadPartSize}
+	opts := &PutObjectOptions{ContentType: "text/plain"}
+	if _, err := uploader.Upload(context.Background(), "bucket", "", "known", bytes.NewReader(content), int64(len(content)), opts); !errors.Is(err, ErrMultipartUploadOptions) {
+		t.Errorf("known size = %v", err)
+	}
+	if _, err := uploader.Upload(context.Background(), "bucket", "", "unknown", &streamReader{bytes.NewReader(content)}, -1, opts); !errors.Is(err, ErrMultipartUploadOptions) {
+		t.Errorf("unknown size = %v", err)
+	}
+	if _, err := uploader.Upload(context.Background(), "bucket", "", "small", &streamReader{bytes.NewReader(content[:10])}, -1, opts); err != nil {
+		t.Errorf("small upload with options = %v", err)
+	}
+	if _, err := uploader.Upload(context.Background(), "bucket", "", "empty", bytes.NewReader(content), int64(len(content)), &PutObjectOptions{}); err != nil {
+		t.Errorf("empty options = %v", err)
+	}
+	checkNoUploads(t, client)
+}
+
+// reader 中的数据少于 size 时不能完成上传
+func TestUploaderShortStream(t *testing.T) {
+	client, cleanup := newTestLocalClient(t)
+	defer cleanup()
+	content := testContent(7 << 20)
+	uploader := &Uploader{Client: client, PartSize: minUploadPartSize}
+	for _, size := range []int64{12 << 20, 10 << 20} {
+		reader := &streamReader{bytes.NewReader(content[:size/2])}
+		if _, err := uploader.Upload(context.Background(), "bucket", "", "short", reader, size, nil); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("size %d: err = %v, want io.ErrUnexpectedEOF", size, err)
+		}
+	}
+	if _, err := client.StatObject("bucket", "", "short"); !errors.Is(err, ErrNoSuchKey) {
+		t.Errorf("truncated object exists: %v", err)
+	}
+	checkNoUploads(t, client)
+}
+
+func TestUploaderRetry(t *testing.T) {
+	client, cleanup := newTestLocalClient(t)
+	defer cleanup()
+	content := testContent(6 << 20)
+	tests := []struct {
+		name     string
+		err      error
+		wantErr  bool
+		attempts int32
+	}{
+		{name: "transient", err: &StorageError{Kind: ErrTransient, Err: errors.New("reset")}, attempts: 4},
+		{name: "throttled", err: &StorageError{Kind: ErrThrottled, Err: errors.New("slow down")}, attempts: 4},
+		{name: "access denied", err: &StorageError{Kind: ErrAccessDenied, Err: errors.New("denied")}, wantErr: true, attempts: 1},
+		{name: "unclassified", err: errors.New("unknown"), wantErr: true, attempts: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			flaky := &flakyClient{StoreClient: client, failures: 2, err: test.err}
+			uploader := &Uploader{Client: flaky, PartSize: minUploadPartSize, Concurrency: 1, RetryDelay: time.Millisecond}
+			_, err := uploader.Upload(context.Background(), "bucket", "", "retry", bytes.NewReader(content), int64(len(content)), nil)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err = %v", err)
+			}
+			if flaky.attempts != test.attempts {
+				t.Errorf("attempts = %d, want %d", flaky.attempts, test.attempts)
+			}
+		})
+	}
+	checkNoUploads(t, client)
+}
+
+// 取消分片上传时一直阻塞到 ctx 结束
+type blockingAbortClient struct {
+	StoreClient
+	hasDeadline bool
+}
+
+func (c *blockingAbortClient) MultipartUploadAbortWithContext(ctx context.Context, bucketName, region, objectKey, uploadId string) error {
+	_, c.hasDeadline = ctx.Deadline()
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// 上传失败后取消分片上传有超时，取消失败时同时返回两个错误
+func TestUploaderAbortError(t *testing.T) {
+	client, cleanup := newTestLocalClient(t)
+	defer cleanup()
+	content := testContent(6 << 20)
+	uploadErr := &StorageError{Kind: ErrAccessDenied, Err: errors.New("denied")}
+
+	flaky := &flakyClient{StoreClient: client, failures: 1, err: uploadErr}
+	uploader := &Uploader{Client: flaky, PartSize: minUploadPartSize}
+	_, err := uploader.Upload(context.Background(), "bucket", "", "abort", bytes.NewReader(content), int64(len(content)), nil)
+	if err != uploadErr {
+		t.Fatalf("err = %v, want %v", err, uploadErr)
+	}
+	checkNoUploads(t, client)
+
+	blocking := &blockingAbortClient{StoreClient: &flakyClient{StoreClient: client, failures: 1, err: uploadErr}}
+	uploader = &Uploader{Client: blocking, PartSize: minUploadPartSize, AbortTimeout: 50 * time.Millisecond}
+	start := time.Now()
+	_, err = uploader.Upload(context.Background(), "bucket", "", "abort", bytes.NewReader(content), int64(len(content)), nil)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("upload returned after %s", elapsed)
+	}
+	if !blocking.hasDeadline {
+		t.Error("abort ctx has no deadline")
+	}
+	var abortErr *UploadAbortError
+	if !errors.As(err, &abortErr) {
+		t.Fatalf("err = %v", err)
+	}
+	if abortErr.Err != uploadErr || !errors.Is(abortErr.AbortErr, context.DeadlineExceeded) || abortErr.UploadId == "" {
+		t.Errorf("err = %+v", abortErr)
+	}
+	if !errors.Is(err, ErrAccessDenied) || IsRetryable(err) {
+		t.Errorf("err = %v should keep the upload error", err)
+	}
+	if err = client.MultipartUploadAbort("bucket", "", "abort", abortErr.UploadId); err != nil {
+		t.Fatal(err)
+	}
+	checkNoUploads(t, client)
+}